@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// GitBackend is everything the add/commit/push flow needs from git. The
+// exec backend shells out to the git binary, the go backend uses go-git and
+// works where git isn't installed.
+type GitBackend interface {
+	Status() (GitStatus, error)
+	// Add stages the given paths, or every change when no path is given.
+	Add(paths ...string) error
+	// Unstage puts the given paths in the index back to HEAD, or removes them
+	// from it before the first commit. The working tree is not touched.
+	Unstage(paths ...string) error
+	// Commit commits the staged changes and returns git's summary of the commit.
+	Commit(message string) (string, error)
+	// Push pushes HEAD to remoteRef on remote, remoteRef being a branch name
+	// or a full ref. With setUpstream the current branch starts tracking it.
+	Push(remote string, remoteRef string, setUpstream bool) (string, error)
+	// Root is the top directory of the working tree. Status paths are
+	// relative to it.
+	Root() (string, error)
+	// GitDir is the absolute path of the .git directory.
+	GitDir() (string, error)
+	// Config returns every value of a git config key like
+	// "branch.main.remote", nil when it isn't set.
+	Config(key string) []string
+	// Remotes lists the names of the configured remotes.
+	Remotes() ([]string, error)
+	// StagedFiles lists the added, copied, modified and renamed files in the
+	// index. Deleted files can't leak anything.
+	StagedFiles() ([]StagedFile, error)
+	// ReadBlob returns the content of the blob with the given hash.
+	ReadBlob(hash string) ([]byte, error)
+}
+
+// StagedFile is one file from GitBackend.StagedFiles, Hash and Size are
+// those of the staged blob.
+type StagedFile struct {
+	Path string
+	Mode string // octal like git prints it, e.g. "100644"
+	Hash string
+	Size int64 // 0 for submodules, their hash is a commit of another repository
+}
+
+// gitlinkMode is the mode of a submodule entry in the index.
+const gitlinkMode = "160000"
+
+// configValue is the last value of key, the one git uses, or "".
+func configValue(repo GitBackend, key string) string {
+	values := repo.Config(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// errors a GitError can wrap, check them with errors.Is
+var (
+	ErrGitNotFound     = errors.New("git is not installed or not in PATH")
+	ErrNotARepository  = errors.New("not a git repository")
+	ErrNothingToCommit = errors.New("nothing to commit")
+	ErrNonFastForward  = errors.New("rejected, the remote has commits that are not local")
+	ErrAuthentication  = errors.New("authentication with the remote failed")
+)
+
+// GitError is a failed git command with what git printed on stderr, so the
+// user sees more than "exit status 1".
+type GitError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Kind     error // one of the Err values above, nil when the failure isn't recognised
+}
+
+func (e *GitError) Error() string {
+	message := strings.TrimSpace(e.Stderr)
+	if message == "" && e.Kind != nil {
+		message = e.Kind.Error()
+	}
+	if message == "" {
+		message = "exit status " + strconv.Itoa(e.ExitCode)
+	}
+	command := "git"
+	if len(e.Args) > 0 {
+		command += " " + e.Args[0]
+	}
+	return command + ": " + message
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Kind
+}
+
+// classifyGitError works out the Kind of a failure from git's output.
+func classifyGitError(output string) error {
+	switch {
+	case strings.Contains(output, "not a git repository"):
+		return ErrNotARepository
+	case strings.Contains(output, "nothing to commit") || strings.Contains(output, "nothing added to commit"):
+		return ErrNothingToCommit
+	case strings.Contains(output, "[rejected]") &&
+		(strings.Contains(output, "non-fast-forward") || strings.Contains(output, "fetch first")):
+		return ErrNonFastForward
+	case strings.Contains(output, "Authentication failed") || strings.Contains(output, "Permission denied (publickey"):
+		return ErrAuthentication
+	}
+	return nil
+}
+
+// execBackend runs the git binary in Dir, "" being the current directory.
+type execBackend struct {
+	Dir string
+}
+
+// run returns stdout and stderr separately, git writes progress and most
+// messages of push/pull to stderr.
+func (b *execBackend) run(args ...string) (string, string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = b.Dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return stdout.String(), stderr.String(), nil
+	}
+
+	gitErr := &GitError{Args: args, ExitCode: -1, Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		gitErr.Kind = ErrGitNotFound
+	case errors.As(err, &exitErr):
+		gitErr.ExitCode = exitErr.ExitCode()
+		gitErr.Kind = classifyGitError(stdout.String() + stderr.String())
+	default:
+		gitErr.Stderr = err.Error()
+	}
+	return stdout.String(), stderr.String(), gitErr
+}
+
+func (b *execBackend) Status() (GitStatus, error) {
+	output, _, err := b.run("status", "--porcelain=v2", "-z", "--branch", "--show-stash")
+	if err != nil {
+		return GitStatus{RemoteBranch: "no remote"}, err
+	}
+	return parsePorcelainV2(output), nil
+}
+
+func (b *execBackend) Add(paths ...string) error {
+	_, _, err := b.run(append([]string{"add", "--all", "--"}, paths...)...)
+	return err
+}
+
+func (b *execBackend) Unstage(paths ...string) error {
+	if _, _, err := b.run(append([]string{"restore", "--staged", "--"}, paths...)...); err != nil {
+		// restore --staged needs a HEAD, before the first commit use rm --cached
+		_, _, err = b.run(append([]string{"rm", "--cached", "--quiet", "--"}, paths...)...)
+		return err
+	}
+	return nil
+}
+
+func (b *execBackend) Commit(message string) (string, error) {
+	output, _, err := b.run("commit", "-m", message)
+	return output, err
+}
+
+func (b *execBackend) Push(remote string, remoteRef string, setUpstream bool) (string, error) {
+	args := []string{"push"}
+	if setUpstream {
+		args = append(args, "--set-upstream")
+	}
+	args = append(args, remote, "HEAD:"+remoteRef)
+	stdout, stderr, err := b.run(args...)
+	return stderr + stdout, err
+}
+
+func (b *execBackend) Root() (string, error) {
+	output, _, err := b.run("rev-parse", "--show-toplevel")
+	return strings.TrimSpace(output), err
+}
+
+func (b *execBackend) GitDir() (string, error) {
+	output, _, err := b.run("rev-parse", "--absolute-git-dir")
+	return strings.TrimSpace(output), err
+}
+
+func (b *execBackend) Config(key string) []string {
+	output, _, err := b.run("config", "--get-all", key)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+func (b *execBackend) Remotes() ([]string, error) {
+	output, _, err := b.run("remote")
+	return strings.Fields(output), err
+}
+
+func (b *execBackend) StagedFiles() ([]StagedFile, error) {
+	output, _, err := b.run("diff", "--cached", "--raw", "-z", "--no-abbrev", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+
+	// ":<old mode> <new mode> <old hash> <new hash> <status>" NUL path, renames
+	// and copies have the old path first
+	var files []StagedFile
+	records := strings.Split(output, "\x00")
+	for i := 0; i < len(records); i++ {
+		fields := strings.Fields(strings.TrimPrefix(records[i], ":"))
+		if len(fields) != 5 || i+1 >= len(records) {
+			continue
+		}
+		if fields[4][0] == 'R' || fields[4][0] == 'C' {
+			i++
+		}
+		i++
+		if i >= len(records) {
+			break
+		}
+		file := StagedFile{Path: records[i], Mode: fields[1], Hash: fields[3]}
+		if file.Mode == gitlinkMode {
+			files = append(files, file)
+			continue
+		}
+		size, _, err := b.run("cat-file", "-s", file.Hash)
+		if err != nil {
+			return nil, err
+		}
+		file.Size, _ = strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (b *execBackend) ReadBlob(hash string) ([]byte, error) {
+	output, _, err := b.run("cat-file", "blob", hash)
+	return []byte(output), err
+}
+
+// dryRunBackend reads through to the real backend but only prints the
+// changes it was asked to make.
+type dryRunBackend struct {
+	GitBackend
+}
+
+func (b dryRunBackend) Add(paths ...string) error {
+	fmt.Println("dry-run: git add --all --", strings.Join(paths, " "))
+	return nil
+}
+
+func (b dryRunBackend) Unstage(paths ...string) error {
+	fmt.Println("dry-run: git restore --staged --", strings.Join(paths, " "))
+	return nil
+}
+
+func (b dryRunBackend) Commit(message string) (string, error) {
+	fmt.Printf("dry-run: git commit -m %q\n", message)
+	return "", nil
+}
+
+func (b dryRunBackend) Push(remote string, remoteRef string, setUpstream bool) (string, error) {
+	flag := ""
+	if setUpstream {
+		flag = "--set-upstream "
+	}
+	fmt.Printf("dry-run: git push %s%s HEAD:%s\n", flag, remote, remoteRef)
+	return "", nil
+}
+
+// backend is what the commands use, set up by runCLI from --backend.
+var backend GitBackend = &execBackend{}
+
+// backendKind is the --backend flag, "exec" or "go".
+var backendKind = "exec"
+
+// newBackend returns the selected backend for the repository at dir. When
+// the git binary can't be found the go backend is used. Adds and commits are
+// recorded in the undo journal, except in a dry run.
+func newBackend(dir string) (GitBackend, error) {
+	kind := backendKind
+	if kind == "exec" {
+		if _, err := exec.LookPath("git"); err != nil {
+			kind = "go"
+		}
+	}
+
+	var selected GitBackend
+	switch kind {
+	case "exec":
+		selected = &execBackend{Dir: dir}
+	case "go":
+		goBackend, err := openGoGitBackend(dir)
+		if err != nil {
+			return nil, err
+		}
+		selected = goBackend
+	default:
+		return nil, fmt.Errorf("unknown backend %q, use exec or go", kind)
+	}
+
+	if dryRun {
+		return dryRunBackend{selected}, nil
+	}
+	return journalBackend{selected, dir}, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	gitindex "github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// goGitBackend implements GitBackend in pure Go with go-git, for machines
+// without a git binary. go-git has no stash and no submodule state in its
+// status, so StashCount and StatusEntry.Submodule stay empty.
+type goGitBackend struct {
+	repo *git.Repository
+}
+
+func openGoGitBackend(dir string) (*goGitBackend, error) {
+	if dir == "" {
+		dir = "."
+	}
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, &GitError{Args: []string{"open"}, Kind: ErrNotARepository}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &goGitBackend{repo: repo}, nil
+}
+
+// statusLetter turns a go-git status code into the porcelain letter, "."
+// for unmodified like porcelain v2 does.
+func statusLetter(code git.StatusCode) string {
+	if code == git.Unmodified {
+		return "."
+	}
+	return string(code)
+}
+
+func (b *goGitBackend) Status() (GitStatus, error) {
+	status := GitStatus{RemoteBranch: "no remote"}
+
+	head, err := b.repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		// no commit yet, HEAD points to an unborn branch
+		if ref, refErr := b.repo.Storer.Reference(plumbing.HEAD); refErr == nil {
+			status.LocalBranch = ref.Target().Short()
+		}
+		status.Oid = "(initial)"
+	case err != nil:
+		return status, err
+	default:
+		status.Oid = head.Hash().String()
+		if head.Name().IsBranch() {
+			status.LocalBranch = head.Name().Short()
+		} else {
+			status.LocalBranch = "(detached)"
+			status.Detached = true
+		}
+	}
+
+	if !status.Detached && status.LocalBranch != "" {
+		b.readUpstream(&status, head)
+	}
+
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return status, err
+	}
+	fileStatus, err := worktree.Status()
+	if err != nil {
+		return status, err
+	}
+
+	// the map has no order, sort like git does
+	paths := make([]string, 0, len(fileStatus))
+	for path := range fileStatus {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file := fileStatus[path]
+		entry := StatusEntry{
+			Kind:     "changed",
+			Index:    statusLetter(file.Staging),
+			Worktree: statusLetter(file.Worktree),
+			Path:     path,
+		}
+		switch {
+		case file.Staging == git.Untracked || file.Worktree == git.Untracked:
+			entry = StatusEntry{Kind: "untracked", Index: "?", Worktree: "?", Path: path}
+		case file.Staging == git.UpdatedButUnmerged || file.Worktree == git.UpdatedButUnmerged:
+			entry.Kind = "unmerged"
+		case file.Staging == git.Renamed || file.Staging == git.Copied:
+			entry.Kind = "renamed"
+			if file.Staging == git.Copied {
+				entry.Kind = "copied"
+			}
+			entry.OrigPath = file.Extra
+		}
+		status.addEntry(entry)
+	}
+	return status, nil
+}
+
+// readUpstream fills in the upstream and the ahead/behind counts.
+func (b *goGitBackend) readUpstream(status *GitStatus, head *plumbing.Reference) {
+	cfg, err := b.repo.Config()
+	if err != nil {
+		return
+	}
+	branch, ok := cfg.Branches[status.LocalBranch]
+	if !ok || branch.Remote == "" || branch.Merge == "" {
+		return
+	}
+	status.Upstream = branch.Remote + "/" + branch.Merge.Short()
+	status.RemoteBranch = status.Upstream
+
+	remoteRef, err := b.repo.Reference(plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short()), true)
+	if err != nil {
+		status.UpstreamGone = true
+		return
+	}
+	if head == nil {
+		return
+	}
+	status.Ahead, status.Behind, _ = b.aheadBehind(head.Hash(), remoteRef.Hash())
+}
+
+// aheadBehind counts the commits only reachable from local and only
+// reachable from remote, like `git rev-list --left-right --count`.
+func (b *goGitBackend) aheadBehind(local plumbing.Hash, remote plumbing.Hash) (int, int, error) {
+	localSet, err := b.ancestors(local)
+	if err != nil {
+		return 0, 0, err
+	}
+	remoteSet, err := b.ancestors(remote)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for hash := range localSet {
+		if !remoteSet[hash] {
+			ahead++
+		}
+	}
+	for hash := range remoteSet {
+		if !localSet[hash] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+func (b *goGitBackend) ancestors(from plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	commits, err := b.repo.Log(&git.LogOptions{From: from})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[plumbing.Hash]bool)
+	err = commits.ForEach(func(commit *object.Commit) error {
+		seen[commit.Hash] = true
+		return nil
+	})
+	return seen, err
+}
+
+func (b *goGitBackend) Add(paths ...string) error {
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return worktree.AddWithOptions(&git.AddOptions{All: true})
+	}
+	// All ignores Path, Add stages a single path, deletions included
+	for _, path := range paths {
+		if _, err := worktree.Add(path); err != nil {
+			return fmt.Errorf("add %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (b *goGitBackend) Unstage(paths ...string) error {
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if _, err := b.repo.Head(); err == nil {
+		return worktree.Restore(&git.RestoreOptions{Staged: true, Files: paths})
+	}
+
+	// no commit yet, there is nothing to restore from, drop the paths from the index
+	index, err := b.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := index.Remove(path); err != nil && !errors.Is(err, gitindex.ErrEntryNotFound) {
+			return err
+		}
+	}
+	return b.repo.Storer.SetIndex(index)
+}
+
+func (b *goGitBackend) Commit(message string) (string, error) {
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	hash, err := worktree.Commit(message, &git.CommitOptions{})
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return "", &GitError{Args: []string{"commit"}, Kind: ErrNothingToCommit}
+	}
+	if err != nil {
+		return "", err
+	}
+	subject := strings.SplitN(message, "\n", 2)[0]
+	return fmt.Sprintf("[%s] %s\n", hash.String()[:7], subject), nil
+}
+
+func (b *goGitBackend) Push(remote string, remoteRef string, setUpstream bool) (string, error) {
+	head, err := b.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	target := plumbing.ReferenceName(remoteRef)
+	if !strings.HasPrefix(remoteRef, "refs/") {
+		target = plumbing.NewBranchReferenceName(remoteRef)
+	}
+	refSpec := config.RefSpec(head.Name().String() + ":" + target.String())
+
+	err = b.repo.Push(&git.PushOptions{RemoteName: remote, RefSpecs: []config.RefSpec{refSpec}})
+	switch {
+	case errors.Is(err, git.NoErrAlreadyUpToDate):
+		return "Everything up-to-date\n", nil
+	case err != nil && strings.Contains(err.Error(), "non-fast-forward"):
+		return "", &GitError{Args: []string{"push"}, Stderr: err.Error(), Kind: ErrNonFastForward}
+	case err != nil && strings.Contains(err.Error(), "authentication"):
+		return "", &GitError{Args: []string{"push"}, Stderr: err.Error(), Kind: ErrAuthentication}
+	case err != nil:
+		return "", err
+	}
+
+	if setUpstream && head.Name().IsBranch() {
+		cfg, err := b.repo.Config()
+		if err != nil {
+			return "", err
+		}
+		cfg.Branches[head.Name().Short()] = &config.Branch{Name: head.Name().Short(), Remote: remote, Merge: target}
+		if err := b.repo.SetConfig(cfg); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s -> %s/%s\n", head.Name().Short(), remote, target.Short()), nil
+}
+
+func (b *goGitBackend) Root() (string, error) {
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	return worktree.Filesystem.Root(), nil
+}
+
+func (b *goGitBackend) GitDir() (string, error) {
+	storage, ok := b.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", errors.New("the repository has no .git directory")
+	}
+	return storage.Filesystem().Root(), nil
+}
+
+// Config reads the repository config merged with the global one. It doesn't
+// know about includes or the system config, the git binary does.
+func (b *goGitBackend) Config(key string) []string {
+	cfg, err := b.repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return nil
+	}
+	// section.subsection.option, the subsection may contain dots
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if first < 0 {
+		return nil
+	}
+	section, option := key[:first], key[last+1:]
+	if !cfg.Raw.HasSection(section) {
+		return nil
+	}
+	if first == last {
+		return cfg.Raw.Section(section).Options.GetAll(option)
+	}
+	subsection := key[first+1 : last]
+	if !cfg.Raw.Section(section).HasSubsection(subsection) {
+		return nil
+	}
+	return cfg.Raw.Section(section).Subsection(subsection).Options.GetAll(option)
+}
+
+func (b *goGitBackend) Remotes() ([]string, error) {
+	remotes, err := b.repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, remote := range remotes {
+		names = append(names, remote.Config().Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *goGitBackend) StagedFiles() ([]StagedFile, error) {
+	worktree, err := b.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	fileStatus, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	index, err := b.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []StagedFile
+	for _, entry := range index.Entries {
+		switch fileStatus.File(entry.Name).Staging {
+		case git.Added, git.Copied, git.Modified, git.Renamed:
+		default:
+			continue
+		}
+		file := StagedFile{Path: entry.Name, Mode: fmt.Sprintf("%06o", uint32(entry.Mode)), Hash: entry.Hash.String()}
+		if file.Mode == gitlinkMode {
+			files = append(files, file)
+			continue
+		}
+		if file.Size, err = b.repo.Storer.EncodedObjectSize(entry.Hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (b *goGitBackend) ReadBlob(hash string) ([]byte, error) {
+	blob, err := b.repo.BlobObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeBackend records what the commands asked for instead of running git.
+type fakeBackend struct {
+	status  GitStatus
+	staged  []string
+	commits []string
+	pushes  []string
+}
+
+func (f *fakeBackend) Status() (GitStatus, error) {
+	return f.status, nil
+}
+
+func (f *fakeBackend) Add(paths ...string) error {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	f.staged = append(f.staged, paths...)
+	return nil
+}
+
+func (f *fakeBackend) Unstage(paths ...string) error {
+	return nil
+}
+
+func (f *fakeBackend) Commit(message string) (string, error) {
+	if len(f.staged) == 0 {
+		return "", &GitError{Args: []string{"commit"}, ExitCode: 1, Kind: ErrNothingToCommit}
+	}
+	f.commits = append(f.commits, message)
+	f.staged = nil
+	return "", nil
+}
+
+func (f *fakeBackend) Push(remote string, remoteRef string, setUpstream bool) (string, error) {
+	f.pushes = append(f.pushes, remote+" "+remoteRef)
+	return "", nil
+}
+
+func (f *fakeBackend) Root() (string, error) {
+	return os.Getwd()
+}
+
+func (f *fakeBackend) GitDir() (string, error) {
+	return filepath.Abs(".git")
+}
+
+func (f *fakeBackend) Config(key string) []string {
+	return nil
+}
+
+func (f *fakeBackend) Remotes() ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeBackend) StagedFiles() ([]StagedFile, error) {
+	return nil, nil
+}
+
+func (f *fakeBackend) ReadBlob(hash string) ([]byte, error) {
+	return nil, errors.New("fakeBackend has no blobs")
+}
+
+// useFakeBackend swaps the package backend for a fake for the length of the
+// test. It runs in an empty directory so nothing can touch a real repository.
+func useFakeBackend(t *testing.T, status GitStatus) *fakeBackend {
+	t.Helper()
+	fake := &fakeBackend{status: status}
+	previous := backend
+	backend = fake
+	t.Cleanup(func() { backend = previous })
+	t.Chdir(t.TempDir())
+	return fake
+}
+
+func TestAddThenCommitGoesThroughBackend(t *testing.T) {
+	status := parsePorcelainV2("# branch.head feature\x00? new.txt\x00")
+	fake := useFakeBackend(t, status)
+
+	if code := addCommand([]string{"new.txt"}); code != exitOK {
+		t.Fatalf("add exit code = %d, want %d", code, exitOK)
+	}
+	if code := commitCommand([]string{"-m", "feat: add new.txt"}); code != exitOK {
+		t.Fatalf("commit exit code = %d, want %d", code, exitOK)
+	}
+	if len(fake.commits) != 1 || fake.commits[0] != "feat: add new.txt" {
+		t.Errorf("commits = %q", fake.commits)
+	}
+}
+
+func TestCommitWithNothingStaged(t *testing.T) {
+	fake := useFakeBackend(t, parsePorcelainV2("# branch.head feature\x00"))
+
+	if code := commitCommand([]string{"-m", "fix: nothing"}); code != exitDirty {
+		t.Errorf("exit code = %d, want %d", code, exitDirty)
+	}
+	if len(fake.commits) != 0 {
+		t.Errorf("commits = %q, want none", fake.commits)
+	}
+}
+
+func TestCommandsRefuseUnmergedPaths(t *testing.T) {
+	status := parsePorcelainV2("# branch.head main\x00u UU N... 100644 100644 100644 100644 a b c d.txt\x00")
+	fake := useFakeBackend(t, status)
+
+	if code := addCommand([]string{"--all"}); code != exitConflict {
+		t.Errorf("add exit code = %d, want %d", code, exitConflict)
+	}
+	if code := pushCommand(nil); code != exitConflict {
+		t.Errorf("push exit code = %d, want %d", code, exitConflict)
+	}
+	if len(fake.staged) != 0 || len(fake.pushes) != 0 {
+		t.Errorf("backend was called: staged %q, pushes %q", fake.staged, fake.pushes)
+	}
+}
+
+func TestClassifyGitError(t *testing.T) {
+	tests := []struct {
+		output string
+		want   error
+	}{
+		{"fatal: not a git repository (or any of the parent directories): .git", ErrNotARepository},
+		{"On branch main\nnothing to commit, working tree clean", ErrNothingToCommit},
+		{" ! [rejected]        main -> main (fetch first)", ErrNonFastForward},
+		{" ! [rejected]        main -> main (non-fast-forward)", ErrNonFastForward},
+		{"fatal: Authentication failed for 'https://example.com/repo.git/'", ErrAuthentication},
+		{"fatal: pathspec 'x' did not match any files", nil},
+	}
+	for _, test := range tests {
+		got := classifyGitError(test.output)
+		if !errors.Is(got, test.want) || (test.want == nil && got != nil) {
+			t.Errorf("classifyGitError(%q) = %v, want %v", test.output, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Branch is a local or remote-tracking branch from `git for-each-ref`.
+type Branch struct {
+	Name         string
+	Remote       bool
+	Current      bool
+	LastCommit   time.Time
+	Upstream     string
+	Ahead        int
+	Behind       int
+	UpstreamGone bool
+}
+
+func isProtected(branch string) bool {
+	return indexOf(settings.ProtectedBranches, branch) >= 0
+}
+
+// parseTrack reads %(upstream:track,nobracket), e.g. "ahead 1, behind 2" or "gone".
+func parseTrack(track string, branch *Branch) {
+	if track == "gone" {
+		branch.UpstreamGone = true
+		return
+	}
+	for _, part := range strings.Split(track, ", ") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			continue
+		}
+		count, _ := strconv.Atoi(fields[1])
+		switch fields[0] {
+		case "ahead":
+			branch.Ahead = count
+		case "behind":
+			branch.Behind = count
+		}
+	}
+}
+
+func listBranches() ([]Branch, error) {
+	format := "--format=%(refname)%00%(refname:short)%00%(committerdate:unix)%00%(upstream:short)%00%(upstream:track,nobracket)%00%(HEAD)"
+	output, err := runGit("for-each-ref", format, "refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []Branch
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 6 {
+			continue
+		}
+		// refs/remotes/origin/HEAD is a pointer, not a branch
+		if strings.HasSuffix(fields[0], "/HEAD") {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(fields[2], 10, 64)
+		branch := Branch{
+			Name:       fields[1],
+			Remote:     strings.HasPrefix(fields[0], "refs/remotes/"),
+			Current:    fields[5] == "*",
+			LastCommit: time.Unix(seconds, 0),
+			Upstream:   fields[3],
+		}
+		parseTrack(fields[4], &branch)
+		branches = append(branches, branch)
+	}
+	return branches, nil
+}
+
+func printBranches(branches []Branch) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  BRANCH\tLAST COMMIT\tUPSTREAM\tAHEAD\tBEHIND")
+	for _, remote := range []bool{false, true} {
+		for _, branch := range branches {
+			if branch.Remote != remote {
+				continue
+			}
+			marker := " "
+			if branch.Current {
+				marker = "*"
+			}
+			upstream := branch.Upstream
+			if branch.UpstreamGone {
+				upstream += " (gone)"
+			}
+			if remote {
+				fmt.Fprintf(table, "%s %s\t%s\t\t\t\n", marker, branch.Name, humanAge(branch.LastCommit))
+				continue
+			}
+			fmt.Fprintf(table, "%s %s\t%s\t%s\t%d\t%d\n", marker, branch.Name, humanAge(branch.LastCommit),
+				upstream, branch.Ahead, branch.Behind)
+		}
+	}
+	table.Flush()
+}
+
+// autoStashMessage marks the stashes made when leaving a branch, so they can
+// be found and restored when coming back to it.
+func autoStashMessage(branch string) string {
+	return "git-tool autostash on " + branch
+}
+
+// switchBranch checks out the branch, creating it from start when create is
+// set. A new branch takes the uncommitted changes along. When switching to an
+// existing branch they are stashed first and the stash left on the target
+// branch, if any, is popped afterwards.
+func switchBranch(name string, create bool, start string) error {
+	status, err := loadGitStatus()
+	if err != nil {
+		return err
+	}
+	if len(status.Conflicted) > 0 || inProgressOperation() != "" {
+		return fmt.Errorf("resolve the conflicts before switching branches")
+	}
+
+	if create {
+		// git switch keeps the changes, they are usually what the new branch is for
+		args := []string{"switch", "--create", name}
+		if start != "" {
+			args = append(args, start)
+		}
+		if _, err := runGitChange(args...); err != nil {
+			return err
+		}
+		fmt.Println("Switched to the new branch", name)
+		return nil
+	}
+
+	park := !status.isClean()
+	if park {
+		fmt.Println("Stashing uncommitted changes on", status.LocalBranch)
+		if err := stashSave(autoStashMessage(status.LocalBranch), true); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runGitChange("switch", name); err != nil {
+		if park {
+			fmt.Println("Switch failed, restoring the stashed changes.")
+			stashApply("stash@{0}", true)
+		}
+		return err
+	}
+	fmt.Println("Switched to", name)
+
+	// bring back what was stashed the last time we left this branch
+	stashes, err := listStashes()
+	if err != nil {
+		return err
+	}
+	for _, stash := range stashes {
+		if strings.HasSuffix(stash.Message, autoStashMessage(name)) {
+			fmt.Println("Restoring changes stashed on", name)
+			if stashApply(stash.Ref, true) != exitOK {
+				return fmt.Errorf("could not restore %s", stash.Ref)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// mergedBranches returns the local branches fully merged into base, except
+// base itself, the current branch and the protected ones.
+func mergedBranches(base string) ([]string, error) {
+	output, err := runGit("branch", "--merged", base, "--format=%(refname:short)%00%(HEAD)")
+	if err != nil {
+		return nil, err
+	}
+	var merged []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 2 || fields[1] == "*" {
+			continue
+		}
+		if fields[0] == base || isProtected(fields[0]) {
+			continue
+		}
+		merged = append(merged, fields[0])
+	}
+	return merged, nil
+}
+
+// defaultBaseBranch is the first protected branch that exists, or the current one.
+func defaultBaseBranch() string {
+	for _, branch := range settings.ProtectedBranches {
+		if _, err := runGit("rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch
+		}
+	}
+	return "HEAD"
+}
+
+func deleteMergedBranches(base string) error {
+	merged, err := mergedBranches(base)
+	if err != nil {
+		return err
+	}
+	if len(merged) == 0 {
+		fmt.Println("No merged branches to delete.")
+		return nil
+	}
+	fmt.Println("Branches merged into", base+":")
+	for _, branch := range merged {
+		fmt.Println(" ", branch)
+	}
+	fmt.Println("Delete them?")
+	if cont() != "1" {
+		return nil
+	}
+	// -d and not -D, git refuses again if a branch turns out not to be merged
+	args := append([]string{"branch", "-d"}, merged...)
+	output, err := runGitChange(args...)
+	fmt.Print(output)
+	return err
+}
+
+// confirmProtectedCommit warns before committing straight to a protected
+// branch. It returns false when the user doesn't want to go on.
+func confirmProtectedCommit(branch string) bool {
+	if !isProtected(branch) {
+		return true
+	}
+	fmt.Printf("Warning: you are about to commit directly to %s, a protected branch.\n", branch)
+	return cont() == "1"
+}
+
+// branchMenu is the interactive branch mode, `git-tool branch` without arguments.
+func branchMenu() int {
+	for {
+		branches, err := listBranches()
+		if err != nil {
+			fmt.Println("error", err)
+			return exitGitError
+		}
+		fmt.Println()
+		printBranches(branches)
+		fmt.Println("\n 1.Switch \n 2.Create \n 3.Delete merged \n 4.Quit")
+
+		choice, ok := readLine(" Enter a choice: ")
+		if !ok {
+			return exitOK
+		}
+		switch choice {
+		case "1":
+			name, _ := readLine("Branch to switch to: ")
+			err = switchBranch(name, false, "")
+		case "2":
+			name, _ := readLine("New branch name: ")
+			start, _ := readLine("Start from (empty for HEAD): ")
+			err = switchBranch(name, true, start)
+		case "3":
+			base, _ := readLine("Merged into (empty for " + defaultBaseBranch() + "): ")
+			if base == "" {
+				base = defaultBaseBranch()
+			}
+			err = deleteMergedBranches(base)
+		case "4":
+			return exitOK
+		default:
+			fmt.Println(" Invalid Choice")
+		}
+		if err != nil {
+			fmt.Println("error", err)
+		}
+	}
+}
+
+func branchCommand(args []string) int {
+	if len(args) == 0 {
+		return branchMenu()
+	}
+
+	var err error
+	command, rest := args[0], args[1:]
+	switch command {
+	case "list":
+		var branches []Branch
+		if branches, err = listBranches(); err == nil {
+			printBranches(branches)
+		}
+	case "new", "switch":
+		if len(rest) == 0 {
+			fmt.Fprintf(os.Stderr, "branch %s: give the branch name\n", command)
+			return exitUsage
+		}
+		start := ""
+		if len(rest) > 1 {
+			start = rest[1]
+		}
+		err = switchBranch(rest[0], command == "new", start)
+	case "delete-merged":
+		flags := flag.NewFlagSet("branch delete-merged", flag.ContinueOnError)
+		base := flags.String("base", defaultBaseBranch(), "delete the branches merged into `branch`")
+		if err := flags.Parse(rest); err != nil {
+			return exitUsage
+		}
+		err = deleteMergedBranches(*base)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown branch command %q\n", command)
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	return exitOK
+}
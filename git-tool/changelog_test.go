@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChangelogEntry(t *testing.T) {
+	entry := parseChangelogEntry(CommitRecord{
+		Subject: "feat(api)!: add links endpoint (#12)",
+		Body:    "Closes #7 and #12.\n\nBREAKING CHANGE: /links moved to /api/links",
+	})
+	if entry.Type != "feat" || entry.Scope != "api" || entry.Subject != "add links endpoint (#12)" {
+		t.Errorf("type %q, scope %q, subject %q", entry.Type, entry.Scope, entry.Subject)
+	}
+	if !entry.Breaking || entry.BreakingNote != "/links moved to /api/links" {
+		t.Errorf("breaking %v, note %q", entry.Breaking, entry.BreakingNote)
+	}
+	if !reflect.DeepEqual(entry.Issues, []string{"12", "7"}) {
+		t.Errorf("issues = %q, want 12 and 7", entry.Issues)
+	}
+
+	if other := parseChangelogEntry(CommitRecord{Subject: "Update README"}); other.Type != "" || other.Subject != "Update README" {
+		t.Errorf("non-conventional subject parsed as type %q, subject %q", other.Type, other.Subject)
+	}
+}
+
+func TestVersionBump(t *testing.T) {
+	fix := ChangelogEntry{Type: "fix"}
+	feat := ChangelogEntry{Type: "feat"}
+	breaking := ChangelogEntry{Type: "refactor", Breaking: true}
+
+	tests := []struct {
+		from    string
+		entries []ChangelogEntry
+		want    string
+	}{
+		{"v1.2.3", []ChangelogEntry{fix}, "v1.2.4"},
+		{"v1.2.3", []ChangelogEntry{fix, feat}, "v1.3.0"},
+		{"v1.2.3", []ChangelogEntry{feat, breaking}, "v2.0.0"},
+		{"0.4.1", []ChangelogEntry{breaking}, "0.5.0"},
+	}
+	for _, test := range tests {
+		version, ok := parseVersion(test.from)
+		if !ok {
+			t.Fatalf("parseVersion(%q) failed", test.from)
+		}
+		if got := version.bump(test.entries).String(); got != test.want {
+			t.Errorf("bump of %s = %s, want %s", test.from, got, test.want)
+		}
+	}
+}
+
+func TestChangelogRange(t *testing.T) {
+	repo := newTestRepo(t)
+	for i, subject := range []string{"feat: one", "feat: two", "fix: three"} {
+		repo.write("file.txt", subject+"\n")
+		repo.commitAll(subject)
+		if i < 2 {
+			repo.git("tag", []string{"v1.0.0", "v1.1.0"}[i])
+		}
+	}
+	notes := func(args ...string) string {
+		t.Helper()
+		output := filepath.Join(t.TempDir(), "CHANGELOG.md")
+		runCLIOrFail(t, append([]string{"changelog", "--output", output}, args...)...)
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// a tag as --to starts at the tag before it, or the root commit
+	if got := notes("--to", "v1.1.0"); !strings.Contains(got, "two") || strings.Contains(got, "one") {
+		t.Errorf("notes for v1.1.0:\n%s\nwant only two", got)
+	}
+	if got := notes("--to", "v1.0.0"); !strings.Contains(got, "one") {
+		t.Errorf("notes for the first tag:\n%s\nwant one", got)
+	}
+	if got := notes(); !strings.Contains(got, "v1.1.1") || !strings.Contains(got, "three") {
+		t.Errorf("unreleased notes:\n%s\nwant three as v1.1.1", got)
+	}
+
+	repo.git("tag", "v1.2.0-rc1")
+	repo.write("file.txt", "four\n")
+	repo.commitAll("fix: four")
+	if code := runCLI([]string{"changelog"}); code != exitUsage {
+		t.Errorf("changelog after a pre-release tag = %d, want %d", code, exitUsage)
+	}
+	if got := notes("--version", "v1.2.0"); !strings.Contains(got, "v1.2.0") || !strings.Contains(got, "four") {
+		t.Errorf("notes with --version:\n%s\nwant four as v1.2.0", got)
+	}
+}
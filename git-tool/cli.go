@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exit codes, so scripts and hooks can tell the outcomes apart
+const (
+	exitOK       = 0  // success, or a clean tree for `status`
+	exitDirty    = 1  // `status` found changes, or there was nothing staged to commit
+	exitGitError = 2  // git itself failed
+	exitConflict = 3  // refused because of conflicts or an unfinished merge/rebase
+	exitBlocked  = 4  // the pre-commit checks or the protected branch check stopped the commit
+	exitUsage    = 64 // bad command line
+)
+
+// global flags
+var (
+	assumeYes bool
+	dryRun    bool
+	repoPath  string
+
+	// invocationDir is where git-tool was started, or --repo. runCLI moves to
+	// the top of the working tree, paths on the command line are relative to this
+	invocationDir string
+)
+
+const usage = `Usage: git-tool [--yes] [--dry-run] [--repo <path>] [--backend exec|go] [command] [args]
+
+Without a command the interactive add, commit and push flow runs.
+
+Commands:
+  status [--json]     print the status, exit 0 when clean and 1 when dirty
+  tui                 full-screen status view to browse the diffs and stage, unstage,
+                      discard or ignore files with a single key
+  add [--all] <path>  stage the given paths, or everything with --all
+  commit [--force] -m <msg>
+                      commit the staged changes, <msg> must be a conventional commit,
+                      --force commits even when the pre-commit checks find problems
+  push                push to the upstream of the current branch
+  sync                pull --rebase from the upstream, then push
+  stash [save [-u] [-m <msg>] | list | show [n] | apply [n] | pop [n] | drop [n]]
+                      manage stashes, without arguments an interactive menu opens
+  branch [list | new <name> [start] | switch <name> | delete-merged [--base b]]
+                      manage branches, without arguments an interactive menu opens
+  log [--author re] [--since date] [--until date] [--grep re] [-n n] [--json] [path...]
+                      browse the history with the files and lines changed per commit
+  scan [--jobs n] [--commit-push -m <msg>] [dir]
+                      report every repository under dir that is dirty, ahead,
+                      behind or has no remote
+  changelog [--from ref] [--to ref] [--tag] [--version v] [--output file]
+                      Markdown release notes grouped by commit type, since the last
+                      tag by default, --tag also tags the next semver version
+  watch [--debounce d]
+                      redraw the status whenever files in the working tree change
+  undo                take back the last add or commit made with git-tool: unstage
+                      the add, reset an unpushed commit or revert a pushed one
+  config show         print the settings from .gittool.yaml and ~/.config/gittool/config.yaml
+
+Flags:
+`
+
+func runCLI(args []string) int {
+	global := flag.NewFlagSet("git-tool", flag.ContinueOnError)
+	global.BoolVar(&assumeYes, "yes", false, "answer yes to every confirmation")
+	global.BoolVar(&dryRun, "dry-run", false, "print the git commands that would change the repository instead of running them")
+	global.StringVar(&repoPath, "repo", "", "run in the repository at `path` instead of the current directory")
+	global.StringVar(&backendKind, "backend", "exec", "git `backend`: exec runs the git binary, go uses go-git so status, add, commit, push and the prompts to do them work without git installed")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if repoPath != "" {
+		if err := os.Chdir(repoPath); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitUsage
+		}
+	}
+
+	rest := global.Args()
+
+	// scan opens a backend per repository it finds, the others work on the
+	// repository in the current directory
+	if len(rest) == 0 || rest[0] != "scan" {
+		selected, err := newBackend("")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			if errors.Is(err, ErrNotARepository) {
+				return exitGitError
+			}
+			return exitUsage
+		}
+		backend = selected
+
+		// status paths are relative to the top of the working tree, git add,
+		// os.Stat and friends need to run from there to find them
+		root, err := backend.Root()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		if invocationDir, err = os.Getwd(); err == nil {
+			invocationDir, _ = filepath.EvalSymlinks(invocationDir)
+		}
+		if err := os.Chdir(root); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+	}
+
+	// scan reads the file of each repository when it commits there
+	var settingsRepo GitBackend
+	if len(rest) == 0 || rest[0] != "scan" {
+		settingsRepo = backend
+	}
+	loaded, err := loadSettings(settingsRepo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitUsage
+	}
+	settings = loaded
+
+	if len(rest) == 0 {
+		// --yes only answers the confirmations, the file picker and the commit
+		// message still need someone typing, without a terminal they would
+		// wait on stdin forever
+		if assumeYes && !isTerminal(os.Stdin) {
+			fmt.Fprintln(os.Stderr, "--yes without a terminal needs a command, e.g.")
+			fmt.Fprintln(os.Stderr, "  git-tool add --all && git-tool commit -m \"fix: ...\" && git-tool --yes push")
+			return exitUsage
+		}
+		return interactive()
+	}
+
+	command, commandArgs := rest[0], rest[1:]
+	switch command {
+	case "status":
+		return statusCommand(commandArgs)
+	case "tui":
+		return runStatusUI()
+	case "add":
+		return addCommand(commandArgs)
+	case "commit":
+		return commitCommand(commandArgs)
+	case "push":
+		return pushCommand(commandArgs)
+	case "sync":
+		return syncCommand(commandArgs)
+	case "scan":
+		return scanCommand(commandArgs)
+	case "stash":
+		return stashCommand(commandArgs)
+	case "branch":
+		return branchCommand(commandArgs)
+	case "log":
+		return logCommand(commandArgs)
+	case "changelog":
+		return changelogCommand(commandArgs)
+	case "watch":
+		return watchCommand(commandArgs)
+	case "undo":
+		return undoCommand(commandArgs)
+	case "config":
+		return configCommand(commandArgs)
+	case "help":
+		global.Usage()
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+	global.Usage()
+	return exitUsage
+}
+
+// userPath turns a path from the command line, relative to invocationDir,
+// into one relative to the top of the working tree, the current directory.
+func userPath(path string) string {
+	if invocationDir == "" {
+		return path
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(invocationDir, path)
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if relative, err := filepath.Rel(root, path); err == nil {
+		return relative
+	}
+	return path
+}
+
+// checkNoConflicts refuses to go on while a merge/rebase is unfinished or
+// there are unmerged paths.
+func checkNoConflicts(status GitStatus) bool {
+	operation := inProgressOperation()
+	if operation != "" {
+		fmt.Fprintf(os.Stderr, "a %s is in progress, finish or abort it first\n", operation)
+		return false
+	}
+	if len(status.Conflicted) > 0 {
+		fmt.Fprintln(os.Stderr, "unresolved conflicts in:", strings.Join(status.Conflicted, ", "))
+		return false
+	}
+	return true
+}
+
+func statusCommand(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the status as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if *asJSON {
+		if err := writeStatusJSON(os.Stdout, status); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+	} else {
+		printStatus(status)
+	}
+	if status.isClean() {
+		return exitOK
+	}
+	return exitDirty
+}
+
+func addCommand(args []string) int {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	all := flags.Bool("all", false, "stage every change in the working tree")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	var paths []string
+	for _, path := range flags.Args() {
+		paths = append(paths, userPath(path))
+	}
+	if !*all && len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "add: give the paths to stage, or --all")
+		return exitUsage
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if !checkNoConflicts(status) {
+		return exitConflict
+	}
+
+	if err := backend.Add(paths...); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	return exitOK
+}
+
+func commitCommand(args []string) int {
+	flags := flag.NewFlagSet("commit", flag.ContinueOnError)
+	message := flags.String("m", "", "commit `message`, in the form type(scope): subject")
+	force := flags.Bool("force", false, "commit even when the pre-commit checks find secrets, large or denied files")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if strings.TrimSpace(*message) == "" {
+		fmt.Fprintln(os.Stderr, "commit: a message is required, use -m")
+		return exitUsage
+	}
+	if err := validateCommitMessage(*message); err != nil {
+		fmt.Fprintln(os.Stderr, "commit:", err)
+		return exitUsage
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if !checkNoConflicts(status) {
+		return exitConflict
+	}
+	if !confirmProtectedCommit(status.LocalBranch) {
+		fmt.Fprintln(os.Stderr, "commit to", status.LocalBranch, "aborted, use --yes to commit anyway")
+		return exitBlocked
+	}
+
+	findings, err := runPreCommitChecks(backend, loadCheckConfig(backend, settings.PreCommitChecks))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if len(findings) > 0 {
+		printFindings(findings)
+		if !*force {
+			fmt.Fprintln(os.Stderr, "commit blocked, use --force to commit anyway")
+			return exitBlocked
+		}
+	}
+
+	output, err := backend.Commit(*message)
+	if errors.Is(err, ErrNothingToCommit) {
+		fmt.Fprintln(os.Stderr, "nothing staged to commit")
+		return exitDirty
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	fmt.Print(output)
+	return exitOK
+}
+
+func pushCommand(args []string) int {
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if !checkNoConflicts(status) {
+		return exitConflict
+	}
+
+	message, ok := gitPush()
+	fmt.Println(message)
+	if !ok {
+		return exitGitError
+	}
+	return exitOK
+}
+
+// syncCommand brings the branch up to date with its upstream and pushes
+// the local commits.
+func syncCommand(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if !checkNoConflicts(status) {
+		return exitConflict
+	}
+
+	if status.Upstream != "" && !status.UpstreamGone {
+		remote, mergeRef := upstreamFor(status.LocalBranch)
+		// --autostash so uncommitted changes don't stop the rebase
+		output, err := runGitChange("pull", "--rebase", "--autostash", remote, mergeRef)
+		fmt.Print(output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			if inProgressOperation() != "" {
+				return exitConflict
+			}
+			return exitGitError
+		}
+	}
+
+	message, ok := gitPush()
+	fmt.Println(message)
+	if !ok {
+		return exitGitError
+	}
+	return exitOK
+}
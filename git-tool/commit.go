@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// commit types from the Conventional Commits spec and the Angular convention
+var commitTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+const maxHeaderLength = 72
+
+var (
+	scopePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9._/-]*$`)
+	headerPattern = regexp.MustCompile(`^([a-z]+)(\(([a-z0-9][a-z0-9._/-]*)\))?(!)?: (\S.*)$`)
+	footerPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z-]*|BREAKING CHANGE)(: | #)\S`)
+)
+
+// CommitMessage holds the parts of a conventional commit message.
+type CommitMessage struct {
+	Type     string
+	Scope    string
+	Breaking bool
+	Subject  string
+	Body     string
+	Footer   string
+}
+
+func (m CommitMessage) Header() string {
+	header := m.Type
+	if m.Scope != "" {
+		header += "(" + m.Scope + ")"
+	}
+	if m.Breaking {
+		header += "!"
+	}
+	return header + ": " + m.Subject
+}
+
+func (m CommitMessage) String() string {
+	message := m.Header()
+	if m.Body != "" {
+		message += "\n\n" + m.Body
+	}
+	if m.Footer != "" {
+		message += "\n\n" + m.Footer
+	}
+	return message
+}
+
+func isCommitType(value string) bool {
+	return indexOf(commitTypes, value) >= 0
+}
+
+func validateSubject(subject string) error {
+	if subject == "" {
+		return fmt.Errorf("subject can't be empty")
+	}
+	if strings.HasSuffix(subject, ".") {
+		return fmt.Errorf("subject should not end with a period")
+	}
+	if strings.Contains(subject, "\n") {
+		return fmt.Errorf("subject must be a single line")
+	}
+	return nil
+}
+
+// validateCommitMessage checks a complete message against the format
+// "type(scope)!: subject", a blank line, then the optional body and footer.
+func validateCommitMessage(message string) error {
+	lines := strings.Split(message, "\n")
+	header := lines[0]
+
+	match := headerPattern.FindStringSubmatch(header)
+	if match == nil {
+		return fmt.Errorf("header %q is not in the form type(scope): subject", header)
+	}
+	if !isCommitType(match[1]) {
+		return fmt.Errorf("unknown type %q, use one of %s", match[1], strings.Join(commitTypes, ", "))
+	}
+	if len(header) > maxHeaderLength {
+		return fmt.Errorf("header is %d characters, keep it under %d", len(header), maxHeaderLength)
+	}
+	if err := validateSubject(match[5]); err != nil {
+		return err
+	}
+	if len(lines) > 1 && lines[1] != "" {
+		return fmt.Errorf("the header must be followed by a blank line")
+	}
+	return nil
+}
+
+// readMultiline reads lines until a line holding only "." and joins them.
+func readMultiline(message string) string {
+	fmt.Println(message)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "." {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// commitTemplate reads commit_template from the settings or .gitmessage from
+// the repository root, falling back to the file set in git's commit.template
+// config. Lines starting with # are hints, the rest is used as the default body.
+func commitTemplate() (hints []string, body string) {
+	path := ""
+	if root, err := backend.Root(); err == nil {
+		candidate := filepath.Join(root, ".gitmessage")
+		if settings.CommitTemplate != "" {
+			candidate = settings.CommitTemplate
+			if !filepath.IsAbs(candidate) {
+				candidate = filepath.Join(root, candidate)
+			}
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			path = candidate
+		}
+	}
+	if path == "" {
+		configured, err := runGit("config", "--path", "commit.template")
+		if err != nil {
+			return nil, ""
+		}
+		path = strings.TrimSpace(configured)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ""
+	}
+	var bodyLines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			hints = append(hints, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+		} else {
+			bodyLines = append(bodyLines, line)
+		}
+	}
+	return hints, strings.TrimSpace(strings.Join(bodyLines, "\n"))
+}
+
+func promptCommitType() (string, bool) {
+	for {
+		fmt.Println("Commit type:")
+		for i, commitType := range commitTypes {
+			fmt.Printf(" %d.%s", i+1, commitType)
+		}
+		fmt.Println()
+		choice, ok := readLine(" Enter a number or type (q to abort): ")
+		if choice == "q" || !ok {
+			return "", false
+		}
+		if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(commitTypes) {
+			return commitTypes[n-1], true
+		}
+		if isCommitType(choice) {
+			return choice, true
+		}
+		fmt.Println(" Invalid Choice")
+	}
+}
+
+// composeCommitMessage asks for each part of a conventional commit and only
+// returns once the message is valid. It returns false if the user aborts,
+// an empty message is never accepted.
+func composeCommitMessage() (string, bool) {
+	hints, templateBody := commitTemplate()
+	for _, hint := range hints {
+		if hint != "" {
+			fmt.Println(" #", hint)
+		}
+	}
+
+	var message CommitMessage
+	var ok bool
+	if message.Type, ok = promptCommitType(); !ok {
+		return "", false
+	}
+
+	for {
+		scope, _ := readLine("Scope (optional): ")
+		message.Scope = strings.ToLower(scope)
+		if message.Scope == "" || scopePattern.MatchString(message.Scope) {
+			break
+		}
+		fmt.Println(" Scope may only contain lowercase letters, digits, '.', '_', '/' and '-'")
+	}
+
+	breaking, _ := readLine("Breaking change? (y/N): ")
+	message.Breaking = breaking == "y"
+
+	for {
+		message.Subject, ok = readLine("Subject (q to abort): ")
+		if message.Subject == "q" || !ok {
+			return "", false
+		}
+		err := validateSubject(message.Subject)
+		if err == nil && len(message.Header()) > maxHeaderLength {
+			err = fmt.Errorf("header is %d characters, keep it under %d", len(message.Header()), maxHeaderLength)
+		}
+		if err == nil {
+			break
+		}
+		fmt.Println(" Invalid subject:", err)
+	}
+
+	prompt := "Body (optional, end with a line containing only \".\"):"
+	if templateBody != "" {
+		prompt = "Body (end with a line containing only \".\", leave empty to use the template):"
+	}
+	message.Body = readMultiline(prompt)
+	if message.Body == "" {
+		message.Body = templateBody
+	}
+
+	for {
+		message.Footer = readMultiline("Footer, e.g. \"Refs: #12\" (optional, end with \".\"):")
+		if message.Breaking && !strings.Contains(message.Footer, "BREAKING CHANGE") {
+			if description, _ := readLine("Describe the breaking change: "); description != "" {
+				message.Footer = strings.TrimSpace(message.Footer + "\nBREAKING CHANGE: " + description)
+			}
+		}
+		if footerErr := validateFooter(message.Footer); footerErr != nil {
+			fmt.Println(" Invalid footer:", footerErr)
+			continue
+		}
+		break
+	}
+
+	full := message.String()
+	if err := validateCommitMessage(full); err != nil {
+		fmt.Println(" Invalid commit message:", err)
+		return "", false
+	}
+
+	fmt.Println("\n" + full + "\n")
+	return full, cont() == "1"
+}
+
+// validateFooter checks every footer line looks like "Token: value" or "Token #value".
+func validateFooter(footer string) error {
+	if footer == "" {
+		return nil
+	}
+	for _, line := range strings.Split(footer, "\n") {
+		if line == "" || strings.HasPrefix(line, " ") {
+			// continuation of the previous footer value
+			continue
+		}
+		if !footerPattern.MatchString(line) {
+			return fmt.Errorf("%q should look like \"Token: value\" or \"Token #value\"", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the checks runPreCommitChecks knows, pre_commit_checks picks from these
+var preCommitCheckNames = []string{"deny-list", "size", "secrets", "entropy"}
+
+// settingsFile is what .gittool.yaml and ~/.config/gittool/config.yaml may
+// contain. Keys left out of a file don't override anything.
+type settingsFile struct {
+	DefaultRemote     string   `yaml:"default_remote"`
+	ProtectedBranches []string `yaml:"protected_branches"`
+	CommitTemplate    string   `yaml:"commit_template"`
+	IgnoredCategories []string `yaml:"ignored_categories"`
+	PreCommitChecks   []string `yaml:"pre_commit_checks"`
+	ConfirmPush       *bool    `yaml:"confirm_push"`
+}
+
+// Settings are the effective settings, the defaults overridden by the user
+// file and then by the repository file.
+type Settings struct {
+	DefaultRemote     string   // remote for branches without an upstream, empty picks origin or the first one
+	ProtectedBranches []string // branches that warn before a direct commit
+	CommitTemplate    string   // path of the commit message template, relative to the repository top
+	IgnoredCategories []string // status categories left out of the status view, by their JSON name
+	PreCommitChecks   []string
+	ConfirmPush       bool // ask before pushing at the end of the interactive flow
+
+	Sources map[string]string // where each setting came from, by key
+}
+
+// the settings of the repository in the current directory, see runCLI
+var settings = defaultSettings()
+
+func defaultSettings() Settings {
+	return Settings{
+		ProtectedBranches: []string{"main", "master"},
+		PreCommitChecks:   preCommitCheckNames,
+		ConfirmPush:       true,
+		Sources:           make(map[string]string),
+	}
+}
+
+// userSettingsPath follows the XDG spec, ~/.config/gittool/config.yaml by default.
+func userSettingsPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gittool", "config.yaml")
+}
+
+// repoSettingsPath is .gittool.yaml at the top of repo, or empty without a
+// repository.
+func repoSettingsPath(repo GitBackend) string {
+	if repo == nil {
+		return ""
+	}
+	top, err := repo.Root()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(top, ".gittool.yaml")
+}
+
+// readSettingsFile returns nil when the file doesn't exist. Unknown keys are
+// an error so a typo doesn't silently do nothing.
+func readSettingsFile(path string) (*settingsFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	reader, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var file settingsFile
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &file, nil
+}
+
+func (file *settingsFile) validate() error {
+	for _, check := range file.PreCommitChecks {
+		if indexOf(preCommitCheckNames, check) < 0 {
+			return fmt.Errorf("unknown pre-commit check %q, the checks are %s", check, strings.Join(preCommitCheckNames, ", "))
+		}
+	}
+	var categories []string
+	for _, category := range statusCategories(GitStatus{}) {
+		categories = append(categories, category.Key)
+	}
+	for _, category := range file.IgnoredCategories {
+		if indexOf(categories, category) < 0 {
+			return fmt.Errorf("unknown status category %q, the categories are %s", category, strings.Join(categories, ", "))
+		}
+	}
+	return nil
+}
+
+// apply overrides the settings with the keys set in the file.
+func (s *Settings) apply(file *settingsFile, source string) {
+	if file == nil {
+		return
+	}
+	if file.DefaultRemote != "" {
+		s.DefaultRemote = file.DefaultRemote
+		s.Sources["default_remote"] = source
+	}
+	// an empty list is a value too, `protected_branches: []` protects nothing
+	if file.ProtectedBranches != nil {
+		s.ProtectedBranches = file.ProtectedBranches
+		s.Sources["protected_branches"] = source
+	}
+	if file.CommitTemplate != "" {
+		s.CommitTemplate = file.CommitTemplate
+		s.Sources["commit_template"] = source
+	}
+	if file.IgnoredCategories != nil {
+		s.IgnoredCategories = file.IgnoredCategories
+		s.Sources["ignored_categories"] = source
+	}
+	if file.PreCommitChecks != nil {
+		s.PreCommitChecks = file.PreCommitChecks
+		s.Sources["pre_commit_checks"] = source
+	}
+	if file.ConfirmPush != nil {
+		s.ConfirmPush = *file.ConfirmPush
+		s.Sources["confirm_push"] = source
+	}
+}
+
+// loadSettings reads the user file and then the file of repo, nil for none.
+func loadSettings(repo GitBackend) (Settings, error) {
+	loaded := defaultSettings()
+	for _, path := range []string{userSettingsPath(), repoSettingsPath(repo)} {
+		file, err := readSettingsFile(path)
+		if err != nil {
+			return loaded, err
+		}
+		loaded.apply(file, path)
+	}
+	return loaded, nil
+}
+
+// isIgnoredCategory reports whether the status category, by display name, is
+// hidden by ignored_categories.
+func isIgnoredCategory(name string) bool {
+	for _, category := range statusCategories(GitStatus{}) {
+		if category.Name == name {
+			return indexOf(settings.IgnoredCategories, category.Key) >= 0
+		}
+	}
+	return false
+}
+
+func printSettings(s Settings) {
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "(none)"
+		}
+		return strings.Join(values, ", ")
+	}
+	orDefault := func(value string, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SETTING\tVALUE\tFROM")
+	rows := [][2]string{
+		{"default_remote", orDefault(s.DefaultRemote, "(origin or the first remote)")},
+		{"protected_branches", list(s.ProtectedBranches)},
+		{"commit_template", orDefault(s.CommitTemplate, "(.gitmessage or commit.template)")},
+		{"ignored_categories", list(s.IgnoredCategories)},
+		{"pre_commit_checks", list(s.PreCommitChecks)},
+		{"confirm_push", fmt.Sprint(s.ConfirmPush)},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", row[0], row[1], orDefault(s.Sources[row[0]], "default"))
+	}
+	table.Flush()
+}
+
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "usage: git-tool config show")
+		return exitUsage
+	}
+	fmt.Println("User file:      ", describePath(userSettingsPath()))
+	fmt.Println("Repository file:", describePath(repoSettingsPath(backend)))
+	fmt.Println()
+	printSettings(settings)
+	return exitOK
+}
+
+// describePath adds "(not found)" to paths that don't exist.
+func describePath(path string) string {
+	if path == "" {
+		return "(not in a repository)"
+	}
+	if _, err := os.Stat(path); err != nil {
+		return path + " (not found)"
+	}
+	return path
+}
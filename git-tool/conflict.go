@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitDir returns the path of the .git directory for the current repository.
+func gitDir() string {
+	dir, err := backend.GitDir()
+	if err != nil {
+		return ".git"
+	}
+	return dir
+}
+
+// inProgressOperation returns "merge", "rebase", "cherry-pick" or "revert"
+// when one of them has stopped half way, or "" when nothing is in progress.
+func inProgressOperation() string {
+	return operationInGitDir(gitDir())
+}
+
+// operationInGitDir looks for the marker files git leaves in the .git
+// directory while an operation is stopped.
+func operationInGitDir(dir string) string {
+	markers := []struct {
+		file      string
+		operation string
+	}{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(filepath.Join(dir, marker.file)); err == nil {
+			return marker.operation
+		}
+	}
+	return ""
+}
+
+// conflictEntries returns the unmerged paths (UU, AA, DU, UD, ...) of the status.
+func conflictEntries(status GitStatus) []StatusEntry {
+	var conflicts []StatusEntry
+	for _, entry := range status.Entries {
+		if entry.Kind == "unmerged" {
+			conflicts = append(conflicts, entry)
+		}
+	}
+	return conflicts
+}
+
+// describeConflict turns the XY letters of an unmerged entry into words.
+func describeConflict(entry StatusEntry) string {
+	switch entry.Index + entry.Worktree {
+	case "UU":
+		return "both modified"
+	case "AA":
+		return "both added"
+	case "DD":
+		return "both deleted"
+	case "AU":
+		return "added by us"
+	case "UA":
+		return "added by them"
+	case "DU":
+		return "deleted by us"
+	case "UD":
+		return "deleted by them"
+	}
+	return entry.Index + entry.Worktree
+}
+
+// hasConflictMarkers reports whether the file still contains <<<<<<< / >>>>>>> lines.
+func hasConflictMarkers(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") {
+			return true
+		}
+	}
+	return false
+}
+
+// takeSide resolves the file with the "ours" or "theirs" version. When that
+// side deleted the file the resolution is to delete it too.
+// Note that during a rebase git swaps the meaning: "ours" is the branch being
+// rebased onto and "theirs" is your commit being replayed.
+func takeSide(entry StatusEntry, side string) error {
+	deleted := (side == "ours" && entry.Index == "D") || (side == "theirs" && entry.Worktree == "D")
+	if deleted {
+		_, err := runGitChange("rm", "--quiet", "--", entry.Path)
+		return err
+	}
+	if _, err := runGitChange("checkout", "--"+side, "--", entry.Path); err != nil {
+		return err
+	}
+	_, err := runGitChange("add", "--", entry.Path)
+	return err
+}
+
+func openInEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// $EDITOR may carry flags, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func markResolved(entry StatusEntry) error {
+	if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
+		_, err := runGitChange("rm", "--quiet", "--", entry.Path)
+		return err
+	}
+	if hasConflictMarkers(entry.Path) {
+		fmt.Println("Warning:", entry.Path, "still contains conflict markers.")
+		if cont() != "1" {
+			return fmt.Errorf("%s not marked as resolved", entry.Path)
+		}
+	}
+	_, err := runGitChange("add", "--", entry.Path)
+	return err
+}
+
+func abortOperation(operation string) error {
+	if operation == "" {
+		return fmt.Errorf("no merge, rebase, cherry-pick or revert in progress")
+	}
+	_, err := runGitChange(operation, "--abort")
+	return err
+}
+
+// continueOperation finishes the merge/rebase/... once every conflict is resolved.
+func continueOperation(operation string) error {
+	if dryRun {
+		fmt.Println("dry-run: git", operation, "--continue")
+		return nil
+	}
+	var cmd *exec.Cmd
+	if operation == "merge" {
+		cmd = exec.Command("git", "commit", "--no-edit")
+	} else {
+		cmd = exec.Command("git", operation, "--continue")
+	}
+	// keep git from opening an editor for the commit message
+	cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+	output, err := cmd.CombinedOutput()
+	fmt.Print(string(output))
+	return err
+}
+
+// resolveConflicts is the guided resolution mode. It walks the user through
+// each unmerged file and refuses to do anything else until they are resolved
+// or the operation is aborted.
+func resolveConflicts(status GitStatus, operation string) {
+	if operation != "" {
+		fmt.Printf("A %s is in progress, add/commit/push is disabled until it is finished.\n", operation)
+	}
+
+	for {
+		conflicts := conflictEntries(status)
+		if len(conflicts) == 0 {
+			break
+		}
+
+		fmt.Println("\nConflicted files:")
+		for i, entry := range conflicts {
+			fmt.Printf(" %d. %s (%s)\n", i+1, entry.Path, describeConflict(entry))
+		}
+		choice, ok := readLine(" Pick a file number, a to abort the " + operationName(operation) + ", q to quit: ")
+
+		if choice == "q" || !ok {
+			return
+		}
+		if choice == "a" {
+			if err := abortOperation(operation); err != nil {
+				fmt.Println("error", err)
+			} else {
+				fmt.Println("Aborted the", operation)
+			}
+			return
+		}
+
+		var index int
+		if _, err := fmt.Sscan(choice, &index); err != nil || index < 1 || index > len(conflicts) {
+			fmt.Println(" Invalid Choice")
+			continue
+		}
+		resolveFile(conflicts[index-1])
+		status = getGitStatus()
+	}
+
+	if operation == "" {
+		fmt.Println("No conflicts left.")
+		return
+	}
+	fmt.Printf("All conflicts resolved, continue the %s?\n", operation)
+	if cont() == "1" {
+		if err := continueOperation(operation); err != nil {
+			fmt.Println("error", err)
+		}
+	}
+}
+
+func resolveFile(entry StatusEntry) {
+	fmt.Printf("\n %s (%s)\n", entry.Path, describeConflict(entry))
+	fmt.Println(" 1.Take ours \n 2.Take theirs \n 3.Open in $EDITOR \n 4.Mark resolved \n 5.Back")
+
+	choice, ok := readLine(" Enter a choice: ")
+	if !ok {
+		return
+	}
+	var err error
+	switch choice {
+	case "1":
+		err = takeSide(entry, "ours")
+	case "2":
+		err = takeSide(entry, "theirs")
+	case "3":
+		if err = openInEditor(entry.Path); err == nil && !hasConflictMarkers(entry.Path) {
+			fmt.Println("No conflict markers left, marking as resolved.")
+			err = markResolved(entry)
+		}
+	case "4":
+		err = markResolved(entry)
+	case "5":
+	default:
+		fmt.Println(" Invalid Choice")
+	}
+	if err != nil {
+		fmt.Println("error", err)
+	}
+}
+
+func operationName(operation string) string {
+	if operation == "" {
+		return "operation"
+	}
+	return operation
+}
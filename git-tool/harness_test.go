@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRepo is a throwaway repository in a temp dir.
+type testRepo struct {
+	t   *testing.T
+	dir string
+}
+
+// isolateGit keeps the tests away from the user's git and git-tool config,
+// and puts the global state the commands change back afterwards.
+func isolateGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	home := t.TempDir()
+	global := filepath.Join(home, ".gitconfig")
+	config := "[user]\n\tname = Test\n\temail = test@example.com\n" +
+		"[init]\n\tdefaultBranch = feature\n" +
+		// git refuses file:// submodules by default since 2.38.1
+		"[protocol \"file\"]\n\tallow = always\n"
+	if err := os.WriteFile(global, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", global)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	previousBackend, previousSettings := backend, settings
+	t.Cleanup(func() {
+		backend, settings = previousBackend, previousSettings
+		assumeYes, dryRun, repoPath, backendKind = false, false, "", "exec"
+		invocationDir = ""
+	})
+	backend = &execBackend{}
+}
+
+// newTestRepo creates an empty repository on branch "feature" and makes it
+// the current directory for the rest of the test.
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	isolateGit(t)
+	repo := &testRepo{t: t, dir: t.TempDir()}
+	repo.git("init", "--quiet")
+	t.Chdir(repo.dir)
+	return repo
+}
+
+// newBareRemote creates a bare repository and adds it as origin.
+func (r *testRepo) newBareRemote() string {
+	r.t.Helper()
+	bare := r.t.TempDir()
+	r.git("init", "--quiet", "--bare", bare)
+	r.git("remote", "add", "origin", bare)
+	return bare
+}
+
+// git runs git in the repository and fails the test when it fails.
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	output, err := runGitIn(r.dir, args...)
+	if err != nil {
+		r.t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return output
+}
+
+func (r *testRepo) write(path string, content string) {
+	r.t.Helper()
+	full := filepath.Join(r.dir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) remove(path string) {
+	r.t.Helper()
+	if err := os.Remove(filepath.Join(r.dir, path)); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// commitAll stages everything and commits it.
+func (r *testRepo) commitAll(message string) {
+	r.t.Helper()
+	r.git("add", "--all")
+	r.git("commit", "--quiet", "-m", message)
+}
+
+// withInput makes the prompts read input instead of stdin for the rest of the test.
+func withInput(t *testing.T, input string) {
+	t.Helper()
+	previous := scanner
+	scanner = bufio.NewScanner(strings.NewReader(input))
+	t.Cleanup(func() { scanner = previous })
+}
+
+// lines makes a file long enough for git's rename detection to match.
+func lines(words ...string) string {
+	return strings.Join(words, "\n") + "\n" + strings.Repeat("filler line\n", 10)
+}
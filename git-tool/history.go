@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// CommitRecord is one commit of the history view.
+type CommitRecord struct {
+	Hash       string       `json:"hash"`
+	Author     string       `json:"author"`
+	Email      string       `json:"email"`
+	Date       time.Time    `json:"date"`
+	Subject    string       `json:"subject"`
+	Body       string       `json:"body,omitempty"`
+	Files      []FileChange `json:"files"`
+	Insertions int          `json:"insertions"`
+	Deletions  int          `json:"deletions"`
+}
+
+// FileChange is one line of `git log --numstat`. Binary files have no line
+// counts, Binary is set instead.
+type FileChange struct {
+	Path       string `json:"path"` // "old => new" for renames, like git prints it
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary,omitempty"`
+}
+
+// LogFilter holds the history filters, empty fields don't filter.
+type LogFilter struct {
+	Author   string // regex on the author name and email
+	Since    string // anything git understands, "2024-01-31" or "2 weeks ago"
+	Until    string
+	Grep     string // extended regex on the commit message
+	Paths    []string
+	Limit    int
+	Range    string // e.g. "v1.2.0..HEAD", empty for the history of HEAD
+	NoMerges bool
+}
+
+func (f LogFilter) gitArgs() []string {
+	// commits are separated by the record separator, fields by NUL
+	args := []string{"log", "--numstat", "--format=%x1e%H%x00%an%x00%ae%x00%aI%x00%s%x00%b%x00"}
+	if f.Limit > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(f.Limit))
+	}
+	if f.Author != "" {
+		args = append(args, "--author="+f.Author)
+	}
+	if f.Since != "" {
+		args = append(args, "--since="+f.Since)
+	}
+	if f.Until != "" {
+		args = append(args, "--until="+f.Until)
+	}
+	if f.Grep != "" {
+		args = append(args, "--extended-regexp", "--grep="+f.Grep)
+	}
+	if f.NoMerges {
+		args = append(args, "--no-merges")
+	}
+	if f.Range != "" {
+		args = append(args, f.Range)
+	}
+	if len(f.Paths) > 0 {
+		args = append(args, "--")
+		args = append(args, f.Paths...)
+	}
+	return args
+}
+
+// parseLog parses the output of `git log` run with LogFilter.gitArgs.
+func parseLog(output string) []CommitRecord {
+	var commits []CommitRecord
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(record, "\x00", 7)
+		if len(fields) != 7 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[3])
+		commit := CommitRecord{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    date,
+			Subject: fields[4],
+			Body:    strings.TrimSpace(fields[5]),
+			Files:   []FileChange{},
+		}
+
+		// "<added>\t<deleted>\t<path>", "-\t-\t<path>" for binary files
+		for _, line := range strings.Split(fields[6], "\n") {
+			parts := strings.SplitN(line, "\t", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			change := FileChange{Path: parts[2]}
+			if parts[0] == "-" {
+				change.Binary = true
+			} else {
+				change.Insertions, _ = strconv.Atoi(parts[0])
+				change.Deletions, _ = strconv.Atoi(parts[1])
+			}
+			commit.Insertions += change.Insertions
+			commit.Deletions += change.Deletions
+			commit.Files = append(commit.Files, change)
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+// loadHistory runs git log, so log and changelog need the git binary even
+// with --backend go. go-git has no date parsing like "2 weeks ago" and no
+// revision ranges.
+func loadHistory(filter LogFilter) ([]CommitRecord, error) {
+	output, err := runGit(filter.gitArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(output), nil
+}
+
+// formatCommit returns the lines shown for one commit in the log view.
+func formatCommit(commit CommitRecord) []string {
+	lines := []string{
+		fmt.Sprintf("%s  %s  %s", commit.Hash[:7], commit.Date.Format("2006-01-02 15:04"), commit.Author),
+		"    " + commit.Subject,
+		fmt.Sprintf("    %d files, +%d -%d", len(commit.Files), commit.Insertions, commit.Deletions),
+	}
+	for _, file := range commit.Files {
+		if file.Binary {
+			lines = append(lines, fmt.Sprintf("      %s (binary)", file.Path))
+		} else {
+			lines = append(lines, fmt.Sprintf("      %s +%d -%d", file.Path, file.Insertions, file.Deletions))
+		}
+	}
+	return append(lines, "")
+}
+
+// isTerminal asks the terminal driver, /dev/null is a character device too.
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+// printHistory prints the commits, a page at a time when both stdin and
+// stdout are a terminal.
+func printHistory(commits []CommitRecord, pageSize int) {
+	if len(commits) == 0 {
+		fmt.Println("No commits match.")
+		return
+	}
+	paging := pageSize > 0 && isTerminal(os.Stdin) && isTerminal(os.Stdout)
+
+	printed := 0
+	for i, commit := range commits {
+		for _, line := range formatCommit(commit) {
+			fmt.Println(line)
+		}
+		printed++
+		if paging && printed == pageSize && i < len(commits)-1 {
+			printed = 0
+			more, ok := readLine(fmt.Sprintf("-- %d of %d, Enter for more, q to quit -- ", i+1, len(commits)))
+			if more == "q" || !ok {
+				return
+			}
+		}
+	}
+}
+
+func logCommand(args []string) int {
+	flags := flag.NewFlagSet("log", flag.ContinueOnError)
+	var filter LogFilter
+	flags.StringVar(&filter.Author, "author", "", "only commits whose author name or email matches `regex`")
+	flags.StringVar(&filter.Since, "since", "", "only commits after `date`, e.g. 2024-01-31 or \"2 weeks ago\"")
+	flags.StringVar(&filter.Until, "until", "", "only commits before `date`")
+	flags.StringVar(&filter.Grep, "grep", "", "only commits whose message matches `regex`")
+	flags.IntVar(&filter.Limit, "n", 0, "show at most `n` commits")
+	pageSize := flags.Int("page", 10, "commits per page in a terminal, 0 to turn paging off")
+	asJSON := flags.Bool("json", false, "print the commits as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	for _, path := range flags.Args() {
+		filter.Paths = append(filter.Paths, userPath(path))
+	}
+
+	commits, err := loadHistory(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+
+	if *asJSON {
+		if commits == nil {
+			commits = []CommitRecord{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(commits); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		return exitOK
+	}
+	printHistory(commits, *pageSize)
+	return exitOK
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// statusSchemaVersion is bumped whenever a field of the JSON output is
+// renamed or removed. Adding fields does not change it.
+const statusSchemaVersion = 1
+
+// The JSON types are kept separate from GitStatus so the internal struct can
+// change without breaking the editor plugins and prompt scripts reading this.
+
+type statusJSON struct {
+	SchemaVersion int            `json:"schema_version"`
+	Branch        branchJSON     `json:"branch"`
+	Clean         bool           `json:"clean"`
+	StashCount    int            `json:"stash_count"`
+	Categories    categoriesJSON `json:"categories"`
+	Files         []fileJSON     `json:"files"`
+}
+
+type branchJSON struct {
+	Head         string `json:"head"`
+	Oid          string `json:"oid"`
+	Detached     bool   `json:"detached"`
+	Upstream     string `json:"upstream"` // "" when the branch has no upstream
+	UpstreamGone bool   `json:"upstream_gone"`
+	Ahead        int    `json:"ahead"`
+	Behind       int    `json:"behind"`
+}
+
+// every category is always present, as an empty array when it has no files
+type categoriesJSON struct {
+	Untracked              []string `json:"untracked"`
+	ModifiedStaged         []string `json:"modified_staged"`
+	ModifiedUnstaged       []string `json:"modified_unstaged"`
+	Added                  []string `json:"added"`
+	AddedThenModified      []string `json:"added_then_modified"`
+	DeletedStaged          []string `json:"deleted_staged"`
+	DeletedUnstaged        []string `json:"deleted_unstaged"`
+	ModifiedStagedModified []string `json:"modified_staged_modified"`
+	Renamed                []string `json:"renamed"`
+	Copied                 []string `json:"copied"`
+	TypeChangedStaged      []string `json:"type_changed_staged"`
+	TypeChangedUnstaged    []string `json:"type_changed_unstaged"`
+	Conflicted             []string `json:"conflicted"`
+}
+
+type fileJSON struct {
+	Path         string         `json:"path"`
+	OrigPath     string         `json:"orig_path,omitempty"`
+	Kind         string         `json:"kind"`
+	Category     string         `json:"category"`
+	Index        string         `json:"index"`
+	Worktree     string         `json:"worktree"`
+	Score        string         `json:"score,omitempty"`
+	ModeHead     string         `json:"mode_head,omitempty"`
+	ModeIndex    string         `json:"mode_index,omitempty"`
+	ModeWorktree string         `json:"mode_worktree,omitempty"`
+	Submodule    *submoduleJSON `json:"submodule,omitempty"`
+}
+
+type submoduleJSON struct {
+	CommitChanged bool `json:"commit_changed"`
+	Modified      bool `json:"modified"`
+	Untracked     bool `json:"untracked"`
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func toStatusJSON(status GitStatus) statusJSON {
+	result := statusJSON{
+		SchemaVersion: statusSchemaVersion,
+		Branch: branchJSON{
+			Head:         status.LocalBranch,
+			Oid:          status.Oid,
+			Detached:     status.Detached,
+			Upstream:     status.Upstream,
+			UpstreamGone: status.UpstreamGone,
+			Ahead:        status.Ahead,
+			Behind:       status.Behind,
+		},
+		Clean:      status.isClean(),
+		StashCount: status.StashCount,
+		Categories: categoriesJSON{
+			Untracked:              nonNil(status.Untracked),
+			ModifiedStaged:         nonNil(status.ModifiedStaged),
+			ModifiedUnstaged:       nonNil(status.ModifiedUnstaged),
+			Added:                  nonNil(status.Added),
+			AddedThenModified:      nonNil(status.AddedThenModified),
+			DeletedStaged:          nonNil(status.DeletedStaged),
+			DeletedUnstaged:        nonNil(status.DeletedUnstaged),
+			ModifiedStagedModified: nonNil(status.ModifiedStagedModified),
+			Renamed:                nonNil(status.Renamed),
+			Copied:                 nonNil(status.Copied),
+			TypeChangedStaged:      nonNil(status.TypeChangedStaged),
+			TypeChangedUnstaged:    nonNil(status.TypeChangedUnstaged),
+			Conflicted:             nonNil(status.Conflicted),
+		},
+		Files: []fileJSON{},
+	}
+
+	for _, entry := range status.Entries {
+		if entry.Kind == "ignored" {
+			continue
+		}
+		file := fileJSON{
+			Path:         entry.Path,
+			OrigPath:     entry.OrigPath,
+			Kind:         entry.Kind,
+			Category:     categoryOf(entry).Key,
+			Index:        entry.Index,
+			Worktree:     entry.Worktree,
+			Score:        entry.Score,
+			ModeHead:     entry.ModeHead,
+			ModeIndex:    entry.ModeIndex,
+			ModeWorktree: entry.ModeWorktree,
+		}
+		if entry.Submodule.IsSubmodule {
+			file.Submodule = &submoduleJSON{
+				CommitChanged: entry.Submodule.CommitChanged,
+				Modified:      entry.Submodule.Modified,
+				Untracked:     entry.Submodule.Untracked,
+			}
+		}
+		result.Files = append(result.Files, file)
+	}
+	return result
+}
+
+func writeStatusJSON(w io.Writer, status GitStatus) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(toStatusJSON(status))
+}
@@ -1,225 +1,262 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 	"os"
 	"bufio"
-	"math/rand"
-	"time"
 )
 
-type GitStatus struct {
-	LocalBranch string
-	RemoteBranch string
-	Untracked []string
-	ModifiedStaged []string
-	ModifiedUnstaged []string
-	Added []string
-	AddedThenModified []string
-	DeletedStaged []string
-	DeletedUnstaged []string
-	ModifiedStagedModified []string
-	Renamed []string
+// one scanner for the whole program, a new scanner per prompt would drop
+// input that was already buffered when stdin is piped
+var scanner = bufio.NewScanner(os.Stdin)
+
+// readLine prints message and reads the answer, ok is false once stdin is
+// closed so the menus can stop instead of asking forever
+func readLine(message string) (line string, ok bool) {
+	fmt.Print(message)
+	if !scanner.Scan() {
+		fmt.Println()
+		return "", false
+	}
+	return strings.TrimSpace(scanner.Text()), true
 }
 
-func getGitStatus() GitStatus {
-	status := GitStatus{}
-	cmd := exec.Command("git", "status", "--porcelain", "--branch")
-	output, err := cmd.Output()
+// runGit runs git with the given arguments and returns its output, on failure
+// the error includes whatever git printed so the user can see why. The
+// commands that aren't part of GitBackend use it, so they need the git binary.
+func runGit(args ...string) (string, error) {
+	return runGitIn("", args...)
+}
 
-	lines := strings.Split(string(output), "\n")
+// runGitIn is runGit in the repository at dir. The error is a *GitError.
+func runGitIn(dir string, args ...string) (string, error) {
+	output, _, err := (&execBackend{Dir: dir}).run(args...)
+	return output, err
+}
 
-	if err !=  nil {
-		fmt.Println("error", err)
-	}
-	
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "##") {
-			trimmedLine := strings.TrimPrefix(line, "## ")
-			parts := strings.Split(trimmedLine, "...")
-			status.LocalBranch = parts[0]
-			if len(parts) > 1 {
-				status.RemoteBranch = parts[1]
-			} else {
-				status.RemoteBranch= "no remote"
-			}
-		}
-		if len(line) < 3 {
-			continue
-		}
-		if strings.HasPrefix(line, " M") {
-			filename := line[3:]
-			status.ModifiedUnstaged = append(status.ModifiedUnstaged, filename)
-		} else if strings.HasPrefix(line, "M ") {
-			filename := line[3:]
-			status.ModifiedStaged = append(status.ModifiedStaged, filename)
-		} else if strings.HasPrefix(line, "A ") {
-			filename := line[3:]
-			status.Added = append(status.Added, filename)
-		} else if strings.HasPrefix(line, "AM") {
-			filename := line[3:]
-			status.AddedThenModified = append(status.AddedThenModified, filename)
-		} else if strings.HasPrefix(line, "D ") {
-			filename := line[3:]
-			status.DeletedStaged = append(status.DeletedStaged, filename)
-		} else if strings.HasPrefix(line, " D") {
-			filename := line[3:]
-			status.DeletedUnstaged = append(status.DeletedUnstaged, filename)
-		} else if strings.HasPrefix(line, "R "){
-			filename := line[3:]
-			status.Renamed = append(status.Renamed, filename)
-		} else if strings.HasPrefix(line, "MM") {
-			filename := line[3:]
-			status.ModifiedStagedModified = append(status.ModifiedStagedModified, filename)
-		} else if strings.HasPrefix(line, "??") {
-			filename := line[3:]
-			status.Untracked = append(status.Untracked, filename)
-		}
+// runGitChange is runGit for commands that modify the repository, with
+// --dry-run they are only printed.
+func runGitChange(args ...string) (string, error) {
+	if dryRun {
+		fmt.Println("dry-run: git", strings.Join(args, " "))
+		return "", nil
 	}
-	return status
+	return runGit(args...)
 }
 
-func gitAddAll() string {
-	cmd := exec.Command("git", "add", ".")
-	output, err := cmd.Output()
-
+func gitCommit() (string, bool) {
+	message, ok := composeCommitMessage()
+	if !ok {
+		return "Commit aborted.", false
+	}
+	output, err := backend.Commit(message)
 	if err != nil {
 		fmt.Println("error", err)
-		fmt.Println(output)
+		return "Commit failed.", false
 	}
-	addMessage := "Added all files successfully."
-	return addMessage
+	fmt.Print(output)
+
+	commitSuccess := "Commited all files successfully."
+	return commitSuccess, true
 }
 
-func gitCommit() string {
-	rand.Seed(time.Now().UnixNano())
-	fmt.Println("Enter your commit message:")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	input := scanner.Text()
-	if input == "" {
-		input = fmt.Sprintf("commit %d", rand.Intn(1000))
+// upstreamFor returns the remote and the remote branch ref that the local
+// branch tracks, e.g. "origin" and "refs/heads/main".
+func upstreamFor(branch string) (string, string) {
+	return upstreamForIn(backend, branch)
+}
+
+func upstreamForIn(repo GitBackend, branch string) (string, string) {
+	remote := configValue(repo, "branch."+branch+".remote")
+	merge := configValue(repo, "branch."+branch+".merge")
+	if remote == "" || merge == "" {
+		return "", ""
+	}
+	return remote, merge
+}
+
+// defaultRemote picks the remote to offer for --set-upstream, origin if it exists.
+func defaultRemote() string {
+	if settings.DefaultRemote != "" {
+		return settings.DefaultRemote
 	}
-	cmd := exec.Command("git", "commit", "-m", input)
-	output, err := cmd.Output()
+	remotes, err := backend.Remotes()
 	if err != nil {
-		fmt.Println("error", err)
+		return ""
+	}
+	for _, remote := range remotes {
+		if remote == "origin" {
+			return remote
+		}
+	}
+	if len(remotes) > 0 {
+		return remotes[0]
+	}
+	return ""
+}
+
+func gitPush() (string, bool) {
+	// re-read the status, the commit we just made changed the ahead count
+	status := getGitStatus()
+	if status.Detached {
+		return "HEAD is detached, checkout a branch before pushing.", false
+	}
+	branch := status.LocalBranch
+
+	if status.Upstream == "" {
+		remote := defaultRemote()
+		if remote == "" {
+			// nothing failed, the commit is there, there is just nowhere to push it
+			return "No remote configured, push skipped. Add one with: git remote add origin <url>", true
+		}
+		fmt.Printf("Branch %s has no upstream. Push and set upstream to %s/%s?\n", branch, remote, branch)
+		if cont() != "1" {
+			return "Push skipped.", true
+		}
+		output, err := backend.Push(remote, branch, true)
+		if err != nil {
+			fmt.Println("error", err)
+			return "Push failed.", false
+		}
+		fmt.Print(output)
+		return "Files pushed successfully.", true
+	}
+
+	if status.UpstreamGone {
+		fmt.Printf("%s does not exist on the remote yet, it will be created.\n", status.Upstream)
 	} else {
-		lines := strings.Split(string(output), "\n")
-		fmt.Println(lines)
+		fmt.Printf("%s is %d ahead, %d behind %s\n", branch, status.Ahead, status.Behind, status.Upstream)
+		if status.Ahead == 0 {
+			return "Nothing to push.", true
+		}
 	}
 
-	commitSuccess := "Commited all files successfully."
-	return commitSuccess
-}
+	remote, mergeRef := upstreamFor(branch)
+	if remote == "" {
+		return "Could not read the upstream of " + branch, false
+	}
 
-func gitPush() string {
-	cmd := exec.Command("git", "push", "origin", "main")
-	output, err := cmd.Output()
+	output, err := backend.Push(remote, mergeRef, false)
+	if errors.Is(err, ErrNonFastForward) {
+		fmt.Println("Push rejected, the remote has commits you don't have.")
+		fmt.Printf("Pull with rebase from %s and push again?\n", status.Upstream)
+		if cont() != "1" {
+			return "Push skipped.", true
+		}
+		if _, pullErr := runGitChange("pull", "--rebase", remote, mergeRef); pullErr != nil {
+			fmt.Println("error", pullErr)
+			return "Pull --rebase failed, run the tool again to resolve the conflicts.", false
+		}
+		output, err = backend.Push(remote, mergeRef, false)
+	}
 	if err != nil {
 		fmt.Println("error", err)
-	} else {
-		lines := strings.Split(string(output), "\n")
-		fmt.Println(lines)
+		return "Push failed.", false
 	}
-
-	pushMessage := "Files pushed successfully."
-	return pushMessage
+	fmt.Print(output)
+	return "Files pushed successfully.", true
 }
 
 func cont() string {
 	fmt.Println("Would you like to continue? 1 to continue, 0 to abort")
-	scanner := bufio.NewScanner(os.Stdin)
+	if assumeYes {
+		fmt.Println("1")
+		return "1"
+	}
 	scanner.Scan()
 	input := scanner.Text()
 	return input
 }
 
-func main () {
-	status := getGitStatus()
-
+func printStatus(status GitStatus) {
 	fmt.Println("Local Branch:", status.LocalBranch)
 	fmt.Println("Remote Branch:", status.RemoteBranch)
 
-	if len(status.Untracked) == 0 &&
-		 len(status.ModifiedStaged) == 0 &&
-		 len(status.ModifiedUnstaged) == 0 &&
-		 len(status.Added) == 0 &&
-		 len(status.AddedThenModified) == 0 &&
-		 len(status.DeletedStaged) == 0 &&
-		 len(status.DeletedUnstaged) == 0 &&
-		 len(status.Renamed) == 0 &&
-		 len(status.ModifiedStagedModified) == 0 {
-				fmt.Println("No files to commit, everything is upto date.")
-		 } else	{
-				if len(status.Untracked) > 0 {
-					fmt.Println("Untracked:")
-					for _, file := range status.Untracked {
-						fmt.Println(" ", file)
-					}
-				}	
-				if len(status.ModifiedStaged) > 0 {
-					fmt.Println("Modified Staged:")
-					for _, file := range status.ModifiedStaged {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.ModifiedUnstaged) > 0 {
-					fmt.Println("Modified Unstaged:")
-					for _, file := range status.ModifiedUnstaged {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.Added) > 0 {
-					fmt.Println("Added:")
-					for _, file := range status.Added {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.AddedThenModified) > 0 {
-					fmt.Println("Added Modified:")
-					for _, file := range status.AddedThenModified {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.DeletedStaged) > 0 {
-					fmt.Println("Deleted Staged:")
-					for _, file := range status.DeletedStaged {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.DeletedUnstaged) > 0 {
-					fmt.Println("Deleted Unstaged:")
-					for _, file := range status.DeletedUnstaged {
-						fmt.Println(" ", file)
-					}
-				}
-				if len(status.ModifiedStagedModified) > 0 {
-					fmt.Println("Modified Staged Modified:")
-					for _, file := range status.ModifiedStagedModified {
-						fmt.Println(" ", file)
-					}
-				}
-				
-				input := cont()
-
-				if input == "1" {
-					addMsg := gitAddAll()
-					fmt.Println(addMsg)
-
-					commitMsg := gitCommit()
-					fmt.Println(commitMsg)
-
-					input := cont()
-					if input == "1" {
-						pushMsg := gitPush()
-						fmt.Println(pushMsg)
-					}
-				} else {
-					fmt.Println("Aborting...")
-				}
+	if status.Ahead > 0 || status.Behind > 0 {
+		fmt.Printf("Ahead: %d, Behind: %d\n", status.Ahead, status.Behind)
+	}
+	if status.StashCount > 0 {
+		fmt.Println("Stashes:", status.StashCount)
+	}
+
+	if status.isClean() {
+		fmt.Println("No files to commit, everything is upto date.")
+		return
+	}
+	for _, category := range statusCategories(status) {
+		if len(category.Files) == 0 || isIgnoredCategory(category.Name) {
+			continue
+		}
+		fmt.Println(category.Name + ":")
+		for _, file := range category.Files {
+			fmt.Println(" ", file)
+		}
 	}
 }
+
+// interactive is the original prompt driven add, commit and push flow, used
+// when the tool is run without a command.
+func interactive() int {
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Println("error", err)
+		return exitGitError
+	}
+	printStatus(status)
+
+	operation := inProgressOperation()
+	if operation != "" || len(status.Conflicted) > 0 {
+		// never stage and commit on top of an unfinished merge/rebase,
+		// conflict markers would end up in the history
+		resolveConflicts(status, operation)
+		return exitConflict
+	}
+	if status.isClean() {
+		return exitOK
+	}
+
+	input := cont()
+
+	if input == "1" {
+		if !confirmProtectedCommit(status.LocalBranch) {
+			fmt.Println("Aborting...")
+			return exitOK
+		}
+		if !stageInteractive(status) {
+			fmt.Println("Aborting...")
+			return exitOK
+		}
+		if !preCommitGate() {
+			fmt.Println("Commit blocked by the pre-commit checks.")
+			return exitBlocked
+		}
+
+		commitMsg, committed := gitCommit()
+		fmt.Println(commitMsg)
+		if !committed {
+			return exitGitError
+		}
+
+		input := "1"
+		if settings.ConfirmPush {
+			input = cont()
+		}
+		if input == "1" {
+			pushMsg, pushed := gitPush()
+			fmt.Println(pushMsg)
+			if !pushed {
+				return exitGitError
+			}
+		}
+	} else {
+		fmt.Println("Aborting...")
+		offerStash()
+	}
+	return exitOK
+}
+
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
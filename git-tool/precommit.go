@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CheckConfig controls the pre-commit scan. The defaults can be changed with
+// git config, e.g. `git config gittool.maxFileSize 10485760` or
+// `git config --add gittool.deny "*.sqlite"`, and whole checks turned off
+// with pre_commit_checks in .gittool.yaml.
+type CheckConfig struct {
+	KnownSecrets     bool     // look for the secretPatterns
+	MaxFileSize      int64    // bytes, 0 turns the size check off
+	DenyList         []string // glob patterns matched against the path and the file name
+	EntropyThreshold float64  // bits per character for base64 like strings, 0 turns the entropy check off
+	HexThreshold     float64  // bits per character for strings of hex digits, which can't go over 4
+	MinSecretLength  int      // shorter strings are never reported as high entropy
+	EntropyIgnore    []string // files full of checksums that would always look like secrets
+}
+
+var defaultDenyList = []string{
+	".env", ".env.*", "*.pem", "*.key", "*.p12", "*.pfx", "*.keystore",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", ".npmrc", ".pypirc", "credentials.json",
+}
+
+var defaultEntropyIgnore = []string{
+	"go.sum", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "Cargo.lock", "poetry.lock", "composer.lock",
+}
+
+func defaultCheckConfig() CheckConfig {
+	return CheckConfig{
+		KnownSecrets:     true,
+		MaxFileSize:      5 * 1024 * 1024,
+		DenyList:         defaultDenyList,
+		// n characters have at most log2(n) bits each and random base64 only
+		// gets near 4.5 from about 32 characters on, below that the check
+		// would either never fire or fire on every identifier
+		EntropyThreshold: 4.5,
+		HexThreshold:     3.0,
+		MinSecretLength:  32,
+		EntropyIgnore:    defaultEntropyIgnore,
+	}
+}
+
+// loadCheckConfig reads the gittool.* keys from git config on top of the
+// defaults and turns off the checks missing from checks.
+func loadCheckConfig(repo GitBackend, checks []string) CheckConfig {
+	config := defaultCheckConfig()
+	if size, err := strconv.ParseInt(configValue(repo, "gittool.maxFileSize"), 10, 64); err == nil {
+		config.MaxFileSize = size
+	}
+	if threshold, err := strconv.ParseFloat(configValue(repo, "gittool.entropyThreshold"), 64); err == nil {
+		config.EntropyThreshold = threshold
+	}
+	if threshold, err := strconv.ParseFloat(configValue(repo, "gittool.hexEntropyThreshold"), 64); err == nil {
+		config.HexThreshold = threshold
+	}
+	for _, value := range repo.Config("gittool.deny") {
+		config.DenyList = append(config.DenyList, strings.Fields(value)...)
+	}
+
+	if indexOf(checks, "deny-list") < 0 {
+		config.DenyList = nil
+	}
+	if indexOf(checks, "size") < 0 {
+		config.MaxFileSize = 0
+	}
+	if indexOf(checks, "secrets") < 0 {
+		config.KnownSecrets = false
+	}
+	if indexOf(checks, "entropy") < 0 {
+		config.EntropyThreshold = 0
+	}
+	return config
+}
+
+// secretPatterns are well known credential formats.
+var secretPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret key", regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"password assignment", regexp.MustCompile(`(?i)(password|passwd|secret|api_?key|token)\s*[=:]\s*["'][^"'\s]{8,}["']`)},
+}
+
+// candidate strings for the entropy check, long runs of base64/hex characters
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{20,}`)
+
+// hex tokens are judged against their own threshold
+var hexPattern = regexp.MustCompile(`^[0-9A-Fa-f]+$`)
+
+// Finding is one problem the scan found in the staged files.
+type Finding struct {
+	Path   string
+	Line   int // 0 when the finding is about the whole file
+	Rule   string
+	Detail string
+}
+
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", f.Path, f.Line, f.Rule, f.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Path, f.Rule, f.Detail)
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	entropy := 0.0
+	length := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isDenied reports whether the path or the file name matches one of the patterns.
+func isDenied(file string, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, file); matched {
+			return pattern, true
+		}
+		if matched, _ := path.Match(pattern, path.Base(file)); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// redact keeps the start of a secret so the user can find it without the
+// whole value ending up in terminal scrollback.
+func redact(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
+
+// scanContent looks for known key formats and high entropy strings.
+func scanContent(file string, content []byte, config CheckConfig) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(string(content), "\n") {
+		reported := false
+		if config.KnownSecrets {
+			for _, secret := range secretPatterns {
+				if match := secret.pattern.FindString(line); match != "" {
+					findings = append(findings, Finding{Path: file, Line: i + 1, Rule: secret.name, Detail: redact(match)})
+					reported = true
+				}
+			}
+		}
+		if reported || config.EntropyThreshold <= 0 {
+			continue
+		}
+		if _, ignored := isDenied(file, config.EntropyIgnore); ignored {
+			continue
+		}
+		for _, token := range tokenPattern.FindAllString(line, -1) {
+			if len(token) < config.MinSecretLength {
+				continue
+			}
+			threshold := config.EntropyThreshold
+			if hexPattern.MatchString(token) && config.HexThreshold > 0 {
+				threshold = config.HexThreshold
+			}
+			if entropy := shannonEntropy(token); entropy >= threshold {
+				detail := fmt.Sprintf("high entropy string %s (%.1f bits/char)", redact(token), entropy)
+				findings = append(findings, Finding{Path: file, Line: i + 1, Rule: "entropy", Detail: detail})
+			}
+		}
+	}
+	return findings
+}
+
+// isBinary uses the same test as git, a NUL byte in the first 8000 bytes.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// runPreCommitChecks scans the staged version of every staged file in repo,
+// not the working tree copy, since that is what would be committed.
+func runPreCommitChecks(repo GitBackend, config CheckConfig) ([]Finding, error) {
+	files, err := repo.StagedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, file := range files {
+		if file.Mode == gitlinkMode {
+			// a submodule commit, its files are checked in the submodule
+			continue
+		}
+		if pattern, denied := isDenied(file.Path, config.DenyList); denied {
+			findings = append(findings, Finding{Path: file.Path, Rule: "deny-list", Detail: "matches " + pattern})
+		}
+
+		if config.MaxFileSize > 0 && file.Size > config.MaxFileSize {
+			detail := fmt.Sprintf("%.1f MB is over the %.1f MB limit", float64(file.Size)/1e6, float64(config.MaxFileSize)/1e6)
+			findings = append(findings, Finding{Path: file.Path, Rule: "size", Detail: detail})
+			// don't read huge blobs into memory just to scan them
+			continue
+		}
+
+		content, err := repo.ReadBlob(file.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(content) {
+			continue
+		}
+		findings = append(findings, scanContent(file.Path, content, config)...)
+	}
+	return findings, nil
+}
+
+func printFindings(findings []Finding) {
+	fmt.Println("Pre-commit checks found problems in the staged files:")
+	for _, finding := range findings {
+		fmt.Println(" ", finding)
+	}
+}
+
+// preCommitGate runs the checks for the interactive flow. It returns true
+// when the commit may go ahead, asking the user to type "override" when
+// something was found.
+func preCommitGate() bool {
+	findings, err := runPreCommitChecks(backend, loadCheckConfig(backend, settings.PreCommitChecks))
+	if err != nil {
+		fmt.Println("error", err)
+		return false
+	}
+	if len(findings) == 0 {
+		return true
+	}
+	printFindings(findings)
+	if assumeYes {
+		// --yes answers confirmations, it doesn't override a blocked commit
+		return false
+	}
+	answer, _ := readLine("Type override to commit anyway, anything else aborts: ")
+	return answer == "override"
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stageItem is one file in the staging picker.
+type stageItem struct {
+	entry    StatusEntry
+	category string
+	selected bool // the whole file should end up staged
+	touched  bool // the user changed the selection, partially staged files are left alone otherwise
+}
+
+func hasStagedChanges(entry StatusEntry) bool {
+	return entry.Kind != "untracked" && entry.Index != "."
+}
+
+func hasUnstagedChanges(entry StatusEntry) bool {
+	return entry.Kind == "untracked" || entry.Worktree != "."
+}
+
+// buildStageItems lists the files grouped by category, in the order the
+// categories first appear.
+func buildStageItems(status GitStatus) ([]stageItem, []string) {
+	var categories []string
+	grouped := make(map[string][]stageItem)
+
+	for _, entry := range status.Entries {
+		if entry.Kind == "ignored" || entry.Kind == "unmerged" {
+			continue
+		}
+		category := categoryOf(entry).Name
+		if isIgnoredCategory(category) {
+			continue
+		}
+		if _, seen := grouped[category]; !seen {
+			categories = append(categories, category)
+		}
+		item := stageItem{
+			entry:    entry,
+			category: category,
+			selected: hasStagedChanges(entry) && !hasUnstagedChanges(entry),
+		}
+		grouped[category] = append(grouped[category], item)
+	}
+
+	var items []stageItem
+	for _, category := range categories {
+		items = append(items, grouped[category]...)
+	}
+	return items, categories
+}
+
+func printStageItems(items []stageItem, categories []string) {
+	current := ""
+	for i, item := range items {
+		if item.category != current {
+			current = item.category
+			fmt.Printf("%s (c%d):\n", current, indexOf(categories, current)+1)
+		}
+		mark := " "
+		if item.selected {
+			mark = "x"
+		} else if !item.touched && hasStagedChanges(item.entry) {
+			// partially staged, stays as it is unless toggled
+			mark = "~"
+		}
+		fmt.Printf("  [%s] %d. %s\n", mark, i+1, item.entry.displayName())
+	}
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// fileDiff returns the staged and unstaged diff of the file, untracked files
+// are diffed against an empty file.
+func fileDiff(entry StatusEntry) string {
+	if entry.Kind == "untracked" {
+		if strings.HasSuffix(entry.Path, "/") {
+			return "Untracked directory, stage it to see the files in it.\n"
+		}
+		// --no-index exits with 1 when the files differ, which they always do here
+		output, err := runGit("diff", "--no-index", "--", "/dev/null", entry.Path)
+		if errors.Is(err, ErrGitNotFound) {
+			return "Diffs need the git binary, it isn't installed.\n"
+		}
+		return output + "\n"
+	}
+	staged, err := runGit("diff", "--cached", "--", entry.Path)
+	if errors.Is(err, ErrGitNotFound) {
+		return "Diffs need the git binary, it isn't installed.\n"
+	}
+	unstaged, _ := runGit("diff", "--", entry.Path)
+	diff := ""
+	if staged != "" {
+		diff += "Staged:\n" + staged + "\n"
+	}
+	if unstaged != "" {
+		diff += "Unstaged:\n" + unstaged + "\n"
+	}
+	return diff
+}
+
+func showFileDiff(entry StatusEntry) {
+	fmt.Println(fileDiff(entry))
+}
+
+// applyStageItems stages the selected files and unstages the deselected ones.
+func applyStageItems(items []stageItem) error {
+	for _, item := range items {
+		entry := item.entry
+		if item.selected && hasUnstagedChanges(entry) {
+			if err := backend.Add(entry.Path); err != nil {
+				return err
+			}
+		}
+		if !item.selected && item.touched && hasStagedChanges(entry) {
+			paths := []string{entry.Path}
+			if entry.OrigPath != "" {
+				paths = append(paths, entry.OrigPath)
+			}
+			if err := unstage(paths); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unstage(paths []string) error {
+	return backend.Unstage(paths...)
+}
+
+// stagedFiles lists the staged changes like `git diff --cached --name-status`,
+// one file per line.
+func stagedFiles() []string {
+	status, err := backend.Status()
+	if err != nil {
+		return nil
+	}
+	var staged []string
+	for _, entry := range status.Entries {
+		if entry.Kind == "ignored" || !hasStagedChanges(entry) {
+			continue
+		}
+		staged = append(staged, entry.Index+"\t"+entry.displayName())
+	}
+	return staged
+}
+
+// stageInteractive lets the user pick what goes into the next commit. It
+// returns false when the user aborts or nothing ends up staged.
+func stageInteractive(status GitStatus) bool {
+	items, categories := buildStageItems(status)
+	if len(items) == 0 {
+		return false
+	}
+
+	for {
+		fmt.Println()
+		printStageItems(items, categories)
+		fmt.Println("\n <n> toggle file, c<n> toggle category, d<n> diff file, a all, u none, s stage selection, q abort")
+		choice, ok := readLine(" Enter a choice: ")
+
+		switch {
+		case choice == "q" || !ok:
+			return false
+		case choice == "a" || choice == "u":
+			for i := range items {
+				items[i].selected = choice == "a"
+				items[i].touched = true
+			}
+		case choice == "s":
+			if err := applyStageItems(items); err != nil {
+				fmt.Println("error", err)
+				return false
+			}
+			return confirmStaged()
+		case strings.HasPrefix(choice, "c"):
+			n, err := strconv.Atoi(choice[1:])
+			if err != nil || n < 1 || n > len(categories) {
+				fmt.Println(" Invalid Choice")
+				continue
+			}
+			toggleCategory(items, categories[n-1])
+		case strings.HasPrefix(choice, "d"):
+			n, err := strconv.Atoi(choice[1:])
+			if err != nil || n < 1 || n > len(items) {
+				fmt.Println(" Invalid Choice")
+				continue
+			}
+			showFileDiff(items[n-1].entry)
+		default:
+			n, err := strconv.Atoi(choice)
+			if err != nil || n < 1 || n > len(items) {
+				fmt.Println(" Invalid Choice")
+				continue
+			}
+			items[n-1].selected = !items[n-1].selected
+			items[n-1].touched = true
+		}
+	}
+}
+
+// toggleCategory selects every file of the category, or deselects them all
+// when they are already selected.
+func toggleCategory(items []stageItem, category string) {
+	allSelected := true
+	for _, item := range items {
+		if item.category == category && !item.selected {
+			allSelected = false
+		}
+	}
+	for i := range items {
+		if items[i].category == category {
+			items[i].selected = !allSelected
+			items[i].touched = true
+		}
+	}
+}
+
+func confirmStaged() bool {
+	staged := stagedFiles()
+	if len(staged) == 0 {
+		fmt.Println("Nothing staged.")
+		return false
+	}
+	fmt.Println("\nFiles to be committed:")
+	for _, line := range staged {
+		fmt.Println(" ", line)
+	}
+	return cont() == "1"
+}
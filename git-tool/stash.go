@@ -0,0 +1,276 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StashEntry is one entry of `git stash list`.
+type StashEntry struct {
+	Ref     string // stash@{n}
+	Created time.Time
+	Message string
+	Files   []string
+}
+
+// stashRef accepts "2" as well as "stash@{2}".
+func stashRef(value string) string {
+	if _, err := strconv.Atoi(value); err == nil {
+		return "stash@{" + value + "}"
+	}
+	return value
+}
+
+// humanAge formats how long ago t was, e.g. "3 hours ago".
+func humanAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age.Minutes()), "minute") + " ago"
+	case age < 24*time.Hour:
+		return plural(int(age.Hours()), "hour") + " ago"
+	case age < 30*24*time.Hour:
+		return plural(int(age.Hours()/24), "day") + " ago"
+	}
+	return t.Format("2006-01-02")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func listStashes() ([]StashEntry, error) {
+	output, err := runGit("stash", "list", "--format=%gd%x00%ct%x00%gs")
+	if err != nil {
+		return nil, err
+	}
+
+	var stashes []StashEntry
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(fields[1], 10, 64)
+		stash := StashEntry{Ref: fields[0], Created: time.Unix(seconds, 0), Message: fields[2]}
+
+		// --include-untracked also lists the files saved with stash -u
+		files, err := runGit("stash", "show", "--include-untracked", "--name-only", stash.Ref)
+		if err != nil {
+			files, _ = runGit("stash", "show", "--name-only", stash.Ref)
+		}
+		stash.Files = strings.Fields(files)
+		stashes = append(stashes, stash)
+	}
+	return stashes, nil
+}
+
+func printStashes(stashes []StashEntry) {
+	if len(stashes) == 0 {
+		fmt.Println("No stashes.")
+		return
+	}
+	for _, stash := range stashes {
+		fmt.Printf("%s  %s  %s\n", stash.Ref, humanAge(stash.Created), stash.Message)
+		for _, file := range stash.Files {
+			fmt.Println("   ", file)
+		}
+	}
+}
+
+func stashSave(message string, includeUntracked bool) error {
+	args := []string{"stash", "push"}
+	if includeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if message != "" {
+		args = append(args, "--message", message)
+	}
+	_, err := runGitChange(args...)
+	return err
+}
+
+// stashApply applies the stash, and drops it too when pop is set. When the
+// stash doesn't apply cleanly git leaves conflict markers and keeps the
+// stash, which is reported as exitConflict.
+func stashApply(ref string, pop bool) int {
+	command := "apply"
+	if pop {
+		command = "pop"
+	}
+	_, err := runGitChange("stash", command, ref)
+	if err == nil {
+		return exitOK
+	}
+
+	status, statusErr := loadGitStatus()
+	if statusErr == nil && len(status.Conflicted) > 0 {
+		fmt.Println("The stash did not apply cleanly, conflicts in:")
+		for _, file := range status.Conflicted {
+			fmt.Println(" ", file)
+		}
+		if pop {
+			fmt.Println("The stash was kept, drop it once the conflicts are resolved.")
+		}
+		return exitConflict
+	}
+	fmt.Fprintln(os.Stderr, "error", err)
+	return exitGitError
+}
+
+func stashShow(ref string) error {
+	output, err := runGit("stash", "show", "--patch", "--include-untracked", ref)
+	if err != nil {
+		output, err = runGit("stash", "show", "--patch", ref)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+	return nil
+}
+
+func stashDrop(ref string) error {
+	_, err := runGitChange("stash", "drop", ref)
+	return err
+}
+
+// offerStash is used when the user aborts the interactive flow, so the
+// changes can be set aside instead of staying dirty.
+func offerStash() {
+	fmt.Println("Stash the changes instead?")
+	if cont() != "1" {
+		return
+	}
+	message, _ := readLine("Stash message (optional): ")
+	untracked, _ := readLine("Include untracked files? (y/N): ")
+	if err := stashSave(message, untracked == "y"); err != nil {
+		fmt.Println("error", err)
+		return
+	}
+	fmt.Println("Changes stashed.")
+}
+
+// stashMenu is the interactive stash mode, `git-tool stash` without arguments.
+func stashMenu() int {
+	for {
+		stashes, err := listStashes()
+		if err != nil {
+			fmt.Println("error", err)
+			return exitGitError
+		}
+		fmt.Println()
+		printStashes(stashes)
+		fmt.Println("\n 1.Save \n 2.Show \n 3.Apply \n 4.Pop \n 5.Drop \n 6.Quit")
+
+		choice, ok := readLine(" Enter a choice: ")
+		if !ok {
+			return exitOK
+		}
+		switch choice {
+		case "1":
+			message, _ := readLine("Stash message (optional): ")
+			untracked, _ := readLine("Include untracked files? (y/N): ")
+			if err := stashSave(message, untracked == "y"); err != nil {
+				fmt.Println("error", err)
+			}
+			continue
+		case "2", "3", "4", "5":
+			if len(stashes) == 0 {
+				continue
+			}
+		case "6":
+			return exitOK
+		default:
+			fmt.Println(" Invalid Choice")
+			continue
+		}
+
+		number, ok := readLine("Stash number: ")
+		if !ok {
+			return exitOK
+		}
+		ref := stashRef(number)
+		switch choice {
+		case "2":
+			err = stashShow(ref)
+		case "3":
+			stashApply(ref, false)
+		case "4":
+			stashApply(ref, true)
+		case "5":
+			fmt.Println("Drop", ref+"?")
+			if cont() == "1" {
+				err = stashDrop(ref)
+			}
+		}
+		if err != nil {
+			fmt.Println("error", err)
+		}
+	}
+}
+
+func stashCommand(args []string) int {
+	if len(args) == 0 {
+		return stashMenu()
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "save", "push":
+		flags := flag.NewFlagSet("stash save", flag.ContinueOnError)
+		message := flags.String("m", "", "stash `message`")
+		untracked := flags.Bool("u", false, "include untracked files")
+		if err := flags.Parse(rest); err != nil {
+			return exitUsage
+		}
+		if err := stashSave(*message, *untracked); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		return exitOK
+	case "list":
+		stashes, err := listStashes()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		printStashes(stashes)
+		return exitOK
+	}
+
+	// the remaining commands take the stash, defaulting to the latest one
+	ref := "stash@{0}"
+	if len(rest) > 0 {
+		ref = stashRef(rest[0])
+	}
+	switch command {
+	case "show":
+		if err := stashShow(ref); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		return exitOK
+	case "apply":
+		return stashApply(ref, false)
+	case "pop":
+		return stashApply(ref, true)
+	case "drop":
+		if err := stashDrop(ref); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			return exitGitError
+		}
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown stash command %q\n", command)
+	return exitUsage
+}
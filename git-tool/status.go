@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubmoduleState is the <sub> field of a porcelain v2 entry, "N..." for
+// regular files and "S<c><m><u>" for submodules.
+type SubmoduleState struct {
+	IsSubmodule   bool
+	CommitChanged bool
+	Modified      bool
+	Untracked     bool
+}
+
+// StatusEntry is one path reported by `git status --porcelain=v2`.
+// Index and Worktree hold the X and Y state letters ("." when unchanged).
+type StatusEntry struct {
+	Kind         string // "changed", "renamed", "copied", "unmerged", "untracked" or "ignored"
+	Index        string
+	Worktree     string
+	Path         string
+	OrigPath     string // source path for renames and copies
+	Score        string // similarity score for renames and copies, e.g. "R100"
+	Submodule    SubmoduleState
+	ModeHead     string
+	ModeIndex    string
+	ModeWorktree string
+	HashHead     string
+	HashIndex    string
+}
+
+type GitStatus struct {
+	Oid                    string
+	LocalBranch            string
+	RemoteBranch           string
+	Upstream               string
+	UpstreamGone           bool // upstream is configured but the remote branch doesn't exist
+	Detached               bool
+	Ahead                  int
+	Behind                 int
+	StashCount             int
+	Entries                []StatusEntry
+	Untracked              []string
+	ModifiedStaged         []string
+	ModifiedUnstaged       []string
+	Added                  []string
+	AddedThenModified      []string
+	DeletedStaged          []string
+	DeletedUnstaged        []string
+	ModifiedStagedModified []string
+	Renamed                []string
+	Copied                 []string
+	TypeChangedStaged      []string
+	TypeChangedUnstaged    []string
+	Conflicted             []string
+}
+
+func getGitStatus() GitStatus {
+	status, err := loadGitStatus()
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	return status
+}
+
+// loadGitStatus is getGitStatus for callers that need to know whether git failed.
+func loadGitStatus() (GitStatus, error) {
+	return backend.Status()
+}
+
+// loadGitStatusIn reads the status of the repository at dir, "" meaning the
+// current directory.
+func loadGitStatusIn(dir string) (GitStatus, error) {
+	repoBackend, err := newBackend(dir)
+	if err != nil {
+		return GitStatus{RemoteBranch: "no remote"}, err
+	}
+	return repoBackend.Status()
+}
+
+// parsePorcelainV2 parses the NUL separated output of
+// `git status --porcelain=v2 -z --branch --show-stash`.
+func parsePorcelainV2(output string) GitStatus {
+	status := GitStatus{RemoteBranch: "no remote"}
+	records := strings.Split(output, "\x00")
+
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" {
+			continue
+		}
+
+		switch record[0] {
+		case '#':
+			parseBranchHeader(&status, record)
+		case '1':
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			fields := strings.SplitN(record, " ", 9)
+			if len(fields) < 9 {
+				continue
+			}
+			entry := newEntry("changed", fields)
+			entry.Path = fields[8]
+			status.addEntry(entry)
+		case '2':
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>, then <origPath> as the next record
+			fields := strings.SplitN(record, " ", 10)
+			if len(fields) < 10 {
+				continue
+			}
+			kind := "renamed"
+			if strings.HasPrefix(fields[8], "C") {
+				kind = "copied"
+			}
+			entry := newEntry(kind, fields)
+			entry.Score = fields[8]
+			entry.Path = fields[9]
+			if i+1 < len(records) {
+				i++
+				entry.OrigPath = records[i]
+			}
+			status.addEntry(entry)
+		case 'u':
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fields := strings.SplitN(record, " ", 11)
+			if len(fields) < 11 {
+				continue
+			}
+			entry := StatusEntry{
+				Kind:         "unmerged",
+				Index:        fields[1][:1],
+				Worktree:     fields[1][1:],
+				Submodule:    parseSubmodule(fields[2]),
+				ModeHead:     fields[3],
+				ModeWorktree: fields[6],
+				HashHead:     fields[7],
+				Path:         fields[10],
+			}
+			status.addEntry(entry)
+		case '?':
+			status.addEntry(StatusEntry{Kind: "untracked", Index: "?", Worktree: "?", Path: record[2:]})
+		case '!':
+			status.addEntry(StatusEntry{Kind: "ignored", Index: "!", Worktree: "!", Path: record[2:]})
+		}
+	}
+	return status
+}
+
+func parseBranchHeader(status *GitStatus, record string) {
+	// "# <name> <value>", e.g. "# branch.head main" or "# stash 2"
+	parts := strings.SplitN(record, " ", 3)
+	if len(parts) < 3 {
+		return
+	}
+	value := parts[2]
+
+	switch parts[1] {
+	case "branch.oid":
+		status.Oid = value
+	case "branch.head":
+		status.LocalBranch = value
+		status.Detached = value == "(detached)"
+	case "branch.upstream":
+		status.Upstream = value
+		status.RemoteBranch = value
+		// git only prints branch.ab when the upstream ref exists
+		status.UpstreamGone = true
+	case "stash":
+		status.StashCount, _ = strconv.Atoi(value)
+	case "branch.ab":
+		// "+<ahead> -<behind>"
+		status.UpstreamGone = false
+		counts := strings.Fields(value)
+		if len(counts) == 2 {
+			status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(counts[0], "+"))
+			status.Behind, _ = strconv.Atoi(strings.TrimPrefix(counts[1], "-"))
+		}
+	}
+}
+
+func newEntry(kind string, fields []string) StatusEntry {
+	return StatusEntry{
+		Kind:         kind,
+		Index:        fields[1][:1],
+		Worktree:     fields[1][1:],
+		Submodule:    parseSubmodule(fields[2]),
+		ModeHead:     fields[3],
+		ModeIndex:    fields[4],
+		ModeWorktree: fields[5],
+		HashHead:     fields[6],
+		HashIndex:    fields[7],
+	}
+}
+
+func parseSubmodule(field string) SubmoduleState {
+	if len(field) != 4 || field[0] != 'S' {
+		return SubmoduleState{}
+	}
+	return SubmoduleState{
+		IsSubmodule:   true,
+		CommitChanged: field[1] == 'C',
+		Modified:      field[2] == 'M',
+		Untracked:     field[3] == 'U',
+	}
+}
+
+// displayName is how an entry is listed in the status categories,
+// renames and copies are shown as "old -> new".
+func (e StatusEntry) displayName() string {
+	if e.OrigPath != "" {
+		return e.OrigPath + " -> " + e.Path
+	}
+	return e.Path
+}
+
+// entryCategoryKeys returns the keys of the categories the entry is listed
+// under, from its index (X) and worktree (Y) state. An entry with staged and
+// unstaged changes, like RM, is in two: the staged one comes first.
+func entryCategoryKeys(entry StatusEntry) []string {
+	switch entry.Kind {
+	case "untracked":
+		return []string{"untracked"}
+	case "ignored":
+		return nil
+	case "unmerged":
+		return []string{"conflicted"}
+	}
+
+	x, y := entry.Index, entry.Worktree
+	if x == "A" && y == "M" {
+		return []string{"added_then_modified"}
+	}
+	if x == "M" && y == "M" {
+		return []string{"modified_staged_modified"}
+	}
+
+	var keys []string
+	switch x {
+	case "M":
+		keys = append(keys, "modified_staged")
+	case "A":
+		keys = append(keys, "added")
+	case "D":
+		keys = append(keys, "deleted_staged")
+	case "R":
+		keys = append(keys, "renamed")
+	case "C":
+		keys = append(keys, "copied")
+	case "T":
+		keys = append(keys, "type_changed_staged")
+	}
+	switch y {
+	case "M":
+		keys = append(keys, "modified_unstaged")
+	case "D":
+		keys = append(keys, "deleted_unstaged")
+	case "T":
+		keys = append(keys, "type_changed_unstaged")
+	}
+	return keys
+}
+
+// categoryOf is the category an entry is shown under where it can only
+// appear once, like the staging picker, the TUI and the JSON files list:
+// the first of entryCategoryKeys.
+func categoryOf(entry StatusEntry) StatusCategory {
+	if keys := entryCategoryKeys(entry); len(keys) > 0 {
+		for _, category := range statusCategories(GitStatus{}) {
+			if category.Key == keys[0] {
+				return category
+			}
+		}
+	}
+	return StatusCategory{Key: "other", Name: "Other"}
+}
+
+// addEntry records the entry and files it under its categories.
+func (status *GitStatus) addEntry(entry StatusEntry) {
+	status.Entries = append(status.Entries, entry)
+	lists := map[string]*[]string{
+		"untracked":                &status.Untracked,
+		"modified_staged":          &status.ModifiedStaged,
+		"modified_unstaged":        &status.ModifiedUnstaged,
+		"added":                    &status.Added,
+		"added_then_modified":      &status.AddedThenModified,
+		"deleted_staged":           &status.DeletedStaged,
+		"deleted_unstaged":         &status.DeletedUnstaged,
+		"modified_staged_modified": &status.ModifiedStagedModified,
+		"renamed":                  &status.Renamed,
+		"copied":                   &status.Copied,
+		"type_changed_staged":      &status.TypeChangedStaged,
+		"type_changed_unstaged":    &status.TypeChangedUnstaged,
+		"conflicted":               &status.Conflicted,
+	}
+	for _, key := range entryCategoryKeys(entry) {
+		*lists[key] = append(*lists[key], entry.displayName())
+	}
+}
+
+// isClean reports whether there is nothing to commit. Ignored files don't count.
+func (status GitStatus) isClean() bool {
+	for _, entry := range status.Entries {
+		if entry.Kind != "ignored" {
+			return false
+		}
+	}
+	return true
+}
+
+// StatusCategory is one group of the status view.
+type StatusCategory struct {
+	Key   string // the name in the JSON output and in ignored_categories
+	Name  string
+	Files []string
+}
+
+// statusCategories returns every category in display order, empty ones included.
+func statusCategories(status GitStatus) []StatusCategory {
+	return []StatusCategory{
+		{"untracked", "Untracked", status.Untracked},
+		{"modified_staged", "Modified Staged", status.ModifiedStaged},
+		{"modified_unstaged", "Modified Unstaged", status.ModifiedUnstaged},
+		{"added", "Added", status.Added},
+		{"added_then_modified", "Added Modified", status.AddedThenModified},
+		{"deleted_staged", "Deleted Staged", status.DeletedStaged},
+		{"deleted_unstaged", "Deleted Unstaged", status.DeletedUnstaged},
+		{"modified_staged_modified", "Modified Staged Modified", status.ModifiedStagedModified},
+		{"renamed", "Renamed", status.Renamed},
+		{"copied", "Copied", status.Copied},
+		{"type_changed_staged", "Type Changed Staged", status.TypeChangedStaged},
+		{"type_changed_unstaged", "Type Changed Unstaged", status.TypeChangedUnstaged},
+		{"conflicted", "Conflicted", status.Conflicted},
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePorcelainV2(t *testing.T) {
+	output := "# branch.oid 1234567890abcdef\x00" +
+		"# branch.head main\x00" +
+		"# branch.upstream origin/main\x00" +
+		"# branch.ab +2 -1\x00" +
+		"# stash 3\x00" +
+		"1 .M N... 100644 100644 100644 aaa aaa file with spaces.txt\x00" +
+		"1 M. SC.. 160000 160000 160000 bbb ccc lib\x00" +
+		"2 R. N... 100644 100644 100644 ddd ddd R100 new.txt\x00old.txt\x00" +
+		"u UU N... 100644 100644 100644 100644 e f g conflict.txt\x00" +
+		"? untracked.txt\x00" +
+		"! build/\x00"
+	status := parsePorcelainV2(output)
+
+	if status.LocalBranch != "main" || status.Upstream != "origin/main" || status.RemoteBranch != "origin/main" {
+		t.Errorf("branch = %q, upstream = %q, remote = %q", status.LocalBranch, status.Upstream, status.RemoteBranch)
+	}
+	if status.Ahead != 2 || status.Behind != 1 || status.StashCount != 3 {
+		t.Errorf("ahead %d, behind %d, stashes %d, want 2, 1, 3", status.Ahead, status.Behind, status.StashCount)
+	}
+	if !reflect.DeepEqual(status.ModifiedUnstaged, []string{"file with spaces.txt"}) {
+		t.Errorf("ModifiedUnstaged = %q", status.ModifiedUnstaged)
+	}
+	if !reflect.DeepEqual(status.Renamed, []string{"old.txt -> new.txt"}) {
+		t.Errorf("Renamed = %q", status.Renamed)
+	}
+	if !reflect.DeepEqual(status.Conflicted, []string{"conflict.txt"}) {
+		t.Errorf("Conflicted = %q", status.Conflicted)
+	}
+	if !reflect.DeepEqual(status.Untracked, []string{"untracked.txt"}) {
+		t.Errorf("Untracked = %q", status.Untracked)
+	}
+	if sub := status.Entries[1].Submodule; !sub.IsSubmodule || !sub.CommitChanged || sub.Modified {
+		t.Errorf("lib submodule state = %+v", sub)
+	}
+	if len(status.Entries) != 6 {
+		t.Errorf("%d entries, want 6 with the ignored one", len(status.Entries))
+	}
+}
+
+// TestGetGitStatusCategories makes every category in a real repository and
+// checks getGitStatus files it, and only it, under the right one.
+func TestGetGitStatusCategories(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *testRepo)
+		want  map[string][]string // category -> files, the others must be empty
+	}{
+		{"untracked", func(r *testRepo) {
+			r.write("new.txt", "new\n")
+		}, map[string][]string{"Untracked": {"new.txt"}}},
+		{"modified staged", func(r *testRepo) {
+			r.write("modify.txt", "changed\n")
+			r.git("add", "modify.txt")
+		}, map[string][]string{"Modified Staged": {"modify.txt"}}},
+		{"modified unstaged", func(r *testRepo) {
+			r.write("modify.txt", "changed\n")
+		}, map[string][]string{"Modified Unstaged": {"modify.txt"}}},
+		{"added", func(r *testRepo) {
+			r.write("new.txt", "new\n")
+			r.git("add", "new.txt")
+		}, map[string][]string{"Added": {"new.txt"}}},
+		{"added then modified", func(r *testRepo) {
+			r.write("new.txt", "new\n")
+			r.git("add", "new.txt")
+			r.write("new.txt", "newer\n")
+		}, map[string][]string{"Added Modified": {"new.txt"}}},
+		{"deleted staged", func(r *testRepo) {
+			r.git("rm", "--quiet", "delete.txt")
+		}, map[string][]string{"Deleted Staged": {"delete.txt"}}},
+		{"deleted unstaged", func(r *testRepo) {
+			r.remove("delete.txt")
+		}, map[string][]string{"Deleted Unstaged": {"delete.txt"}}},
+		{"modified staged and modified again", func(r *testRepo) {
+			r.write("modify.txt", "changed\n")
+			r.git("add", "modify.txt")
+			r.write("modify.txt", "changed again\n")
+		}, map[string][]string{"Modified Staged Modified": {"modify.txt"}}},
+		{"renamed", func(r *testRepo) {
+			r.git("mv", "rename.txt", "moved.txt")
+		}, map[string][]string{"Renamed": {"rename.txt -> moved.txt"}}},
+		{"renamed and modified", func(r *testRepo) {
+			r.git("mv", "rename.txt", "moved.txt")
+			r.write("moved.txt", lines("rename me", "edited"))
+		}, map[string][]string{
+			"Renamed":           {"rename.txt -> moved.txt"},
+			"Modified Unstaged": {"rename.txt -> moved.txt"},
+		}},
+		{"copied", func(r *testRepo) {
+			// status only looks for copies of files that changed too
+			r.git("config", "status.renames", "copies")
+			r.write("copy.txt", lines("rename me"))
+			r.write("rename.txt", lines("rename me", "one more"))
+			r.git("add", "copy.txt", "rename.txt")
+		}, map[string][]string{
+			"Copied":          {"rename.txt -> copy.txt"},
+			"Modified Staged": {"rename.txt"},
+		}},
+		{"type changed staged", func(r *testRepo) {
+			r.remove("modify.txt")
+			if err := os.Symlink("keep.txt", filepath.Join(r.dir, "modify.txt")); err != nil {
+				r.t.Skip("no symlinks:", err)
+			}
+			r.git("add", "modify.txt")
+		}, map[string][]string{"Type Changed Staged": {"modify.txt"}}},
+		{"type changed unstaged", func(r *testRepo) {
+			r.remove("modify.txt")
+			if err := os.Symlink("keep.txt", filepath.Join(r.dir, "modify.txt")); err != nil {
+				r.t.Skip("no symlinks:", err)
+			}
+		}, map[string][]string{"Type Changed Unstaged": {"modify.txt"}}},
+		{"both modified conflict", func(r *testRepo) {
+			r.git("switch", "--quiet", "--create", "other")
+			r.write("modify.txt", "theirs\n")
+			r.commitAll("theirs")
+			r.git("switch", "--quiet", "feature")
+			r.write("modify.txt", "ours\n")
+			r.commitAll("ours")
+			runGit("merge", "other")
+		}, map[string][]string{"Conflicted": {"modify.txt"}}},
+		{"deleted by them conflict", func(r *testRepo) {
+			r.git("switch", "--quiet", "--create", "other")
+			r.git("rm", "--quiet", "modify.txt")
+			r.commitAll("delete")
+			r.git("switch", "--quiet", "feature")
+			r.write("modify.txt", "ours\n")
+			r.commitAll("ours")
+			runGit("merge", "other")
+		}, map[string][]string{"Conflicted": {"modify.txt"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			repo.write("keep.txt", "keep\n")
+			repo.write("modify.txt", "original\n")
+			repo.write("delete.txt", "delete me\n")
+			repo.write("rename.txt", lines("rename me"))
+			repo.commitAll("initial")
+
+			test.setup(repo)
+			status := getGitStatus()
+
+			for _, category := range statusCategories(status) {
+				if want := test.want[category.Name]; !reflect.DeepEqual(category.Files, want) {
+					t.Errorf("%s = %q, want %q", category.Name, category.Files, want)
+				}
+			}
+			for _, entry := range status.Entries {
+				if got := categoryOf(entry).Name; test.want[got] == nil {
+					t.Errorf("categoryOf(%s) = %q, not one of the expected categories", entry.Path, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetGitStatusConflictReportsMerge(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("file.txt", "base\n")
+	repo.commitAll("initial")
+	repo.git("switch", "--quiet", "--create", "other")
+	repo.write("file.txt", "theirs\n")
+	repo.commitAll("theirs")
+	repo.git("switch", "--quiet", "feature")
+	repo.write("file.txt", "ours\n")
+	repo.commitAll("ours")
+	if _, err := runGit("merge", "other"); err == nil {
+		t.Fatal("merge succeeded, want a conflict")
+	}
+
+	if operation := inProgressOperation(); operation != "merge" {
+		t.Errorf("inProgressOperation() = %q, want merge", operation)
+	}
+	entry := getGitStatus().Entries[0]
+	if entry.Kind != "unmerged" || entry.Index != "U" || entry.Worktree != "U" {
+		t.Errorf("entry = %+v, want an unmerged UU entry", entry)
+	}
+}
+
+func TestGetGitStatusSubmodule(t *testing.T) {
+	lib := newTestRepo(t)
+	lib.write("lib.go", "package lib\n")
+	lib.commitAll("lib")
+
+	repo := newTestRepo(t)
+	repo.write("main.go", "package main\n")
+	repo.git("submodule", "--quiet", "add", lib.dir, "lib")
+	repo.commitAll("add lib")
+
+	if status := getGitStatus(); !status.isClean() {
+		t.Fatalf("status after adding the submodule = %+v, want clean", status.Entries)
+	}
+
+	sub := &testRepo{t: t, dir: filepath.Join(repo.dir, "lib")}
+	sub.write("lib.go", "package lib // changed\n")
+	sub.write("extra.go", "package lib\n")
+
+	status := getGitStatus()
+	if !reflect.DeepEqual(status.ModifiedUnstaged, []string{"lib"}) {
+		t.Fatalf("ModifiedUnstaged = %q, want lib", status.ModifiedUnstaged)
+	}
+	want := SubmoduleState{IsSubmodule: true, Modified: true, Untracked: true}
+	if got := status.Entries[0].Submodule; got != want {
+		t.Errorf("submodule state = %+v, want %+v", got, want)
+	}
+
+	sub.commitAll("change lib")
+	status = getGitStatus()
+	want = SubmoduleState{IsSubmodule: true, CommitChanged: true}
+	if got := status.Entries[0].Submodule; got != want {
+		t.Errorf("submodule state after a commit = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetGitStatusBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.newBareRemote()
+	repo.write("file.txt", "one\n")
+	repo.commitAll("one")
+	repo.git("push", "--quiet", "--set-upstream", "origin", "feature")
+
+	repo.write("file.txt", "two\n")
+	repo.commitAll("two")
+	status := getGitStatus()
+	if status.Upstream != "origin/feature" || status.Ahead != 1 || status.Behind != 0 {
+		t.Errorf("upstream %q, ahead %d, behind %d, want origin/feature, 1, 0", status.Upstream, status.Ahead, status.Behind)
+	}
+
+	repo.git("reset", "--quiet", "--hard", "HEAD~1")
+	repo.git("push", "--quiet", "--force", "origin", "feature")
+	repo.write("file.txt", "three\n")
+	repo.git("stash", "push", "--quiet")
+	status = getGitStatus()
+	if status.Ahead != 0 || status.StashCount != 1 {
+		t.Errorf("ahead %d, stashes %d, want 0, 1", status.Ahead, status.StashCount)
+	}
+
+	// what a fetch --prune leaves behind after someone deleted the branch
+	repo.git("update-ref", "-d", "refs/remotes/origin/feature")
+	if status := getGitStatus(); !status.UpstreamGone {
+		t.Errorf("UpstreamGone = false after deleting the remote branch")
+	}
+
+	repo.git("switch", "--quiet", "--detach", "HEAD")
+	if status := getGitStatus(); !status.Detached {
+		t.Errorf("Detached = false on a detached HEAD, branch %q", status.LocalBranch)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used by the status UI
+const (
+	ansiReset       = "\x1b[0m"
+	ansiBold        = "\x1b[1m"
+	ansiReverse     = "\x1b[7m"
+	ansiRed         = "\x1b[31m"
+	ansiGreen       = "\x1b[32m"
+	ansiYellow      = "\x1b[33m"
+	ansiBlue        = "\x1b[34m"
+	ansiMagenta     = "\x1b[35m"
+	ansiCyan        = "\x1b[36m"
+	ansiGray        = "\x1b[90m"
+	ansiClearLine   = "\x1b[K"
+	ansiHome        = "\x1b[H"
+	ansiAltScreen   = "\x1b[?1049h"
+	ansiMainScreen  = "\x1b[?1049l"
+	ansiHideCursor  = "\x1b[?25l"
+	ansiShowCursor  = "\x1b[?25h"
+	ansiClearScreen = "\x1b[2J"
+)
+
+// green is staged, yellow unstaged, cyan both, red needs attention
+var categoryColors = map[string]string{
+	"Untracked":                ansiRed,
+	"Modified Staged":          ansiGreen,
+	"Modified Unstaged":        ansiYellow,
+	"Added":                    ansiGreen,
+	"Added Modified":           ansiCyan,
+	"Deleted Staged":           ansiGreen,
+	"Deleted Unstaged":         ansiYellow,
+	"Modified Staged Modified": ansiCyan,
+	"Renamed":                  ansiBlue,
+	"Copied":                   ansiBlue,
+	"Type Changed Staged":      ansiMagenta,
+	"Type Changed Unstaged":    ansiMagenta,
+	"Conflicted":               ansiBold + ansiRed,
+}
+
+const tuiHelp = "↑↓/jk move  s stage  u unstage  d discard  i ignore  J/K scroll diff  r refresh  q quit"
+
+// uiRow is a line of the file list, a category header or a file.
+type uiRow struct {
+	category string
+	count    int // files in the category, headers only
+	entry    *StatusEntry
+}
+
+// statusUI is the state of the full-screen status view.
+type statusUI struct {
+	status  GitStatus
+	rows    []uiRow
+	cursor  int // index into rows, always a file row while there are files
+	top     int // first row shown in the file list
+	diff    []string
+	diffTop int
+	message string
+}
+
+// load re-reads the status and keeps the cursor on the same file if it is still there.
+func (ui *statusUI) load() error {
+	selected := ""
+	if entry := ui.selected(); entry != nil {
+		selected = entry.Path
+	}
+
+	status, err := loadGitStatus()
+	if err != nil {
+		return err
+	}
+	ui.status = status
+	ui.rows = nil
+	for _, category := range statusCategories(status) {
+		if isIgnoredCategory(category.Name) {
+			continue
+		}
+		var files []uiRow
+		for i := range status.Entries {
+			entry := &status.Entries[i]
+			if entry.Kind != "ignored" && categoryOf(*entry).Name == category.Name {
+				files = append(files, uiRow{category: category.Name, entry: entry})
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		ui.rows = append(ui.rows, uiRow{category: category.Name, count: len(files)})
+		ui.rows = append(ui.rows, files...)
+	}
+
+	ui.cursor = 0
+	for i, row := range ui.rows {
+		if row.entry != nil && row.entry.Path == selected {
+			ui.cursor = i
+			break
+		}
+	}
+	ui.move(0)
+	ui.loadDiff()
+	return nil
+}
+
+func (ui *statusUI) selected() *StatusEntry {
+	if ui.cursor < len(ui.rows) {
+		return ui.rows[ui.cursor].entry
+	}
+	return nil
+}
+
+func (ui *statusUI) loadDiff() {
+	ui.diff, ui.diffTop = nil, 0
+	if entry := ui.selected(); entry != nil {
+		ui.diff = strings.Split(strings.TrimRight(fileDiff(*entry), "\n"), "\n")
+	}
+}
+
+// move moves the cursor by delta files, skipping the category headers.
+func (ui *statusUI) move(delta int) {
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	cursor := ui.cursor
+	for i := cursor + step; i >= 0 && i < len(ui.rows) && delta > 0; i += step {
+		if ui.rows[i].entry != nil {
+			cursor = i
+			delta--
+		}
+	}
+	// land on a file when the cursor sits on a header, e.g. after a reload
+	for cursor < len(ui.rows) && ui.rows[cursor].entry == nil {
+		cursor++
+	}
+	if cursor < len(ui.rows) {
+		ui.cursor = cursor
+	}
+}
+
+// fit cuts or pads s to exactly width characters.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "\t", "    ")
+	if count := utf8.RuneCountInString(s); count <= width {
+		return s + strings.Repeat(" ", width-count)
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
+
+func diffLineColor(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+		strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+		return ansiBold
+	case strings.HasPrefix(line, "@@"):
+		return ansiCyan
+	case strings.HasPrefix(line, "+"):
+		return ansiGreen
+	case strings.HasPrefix(line, "-"):
+		return ansiRed
+	case line == "Staged:" || line == "Unstaged:":
+		return ansiBold + ansiYellow
+	}
+	return ""
+}
+
+// render draws the whole screen: a header, the file list on the left, the
+// diff of the selected file on the right and a help or message line.
+func (ui *statusUI) render(width, height int) string {
+	listWidth := width * 2 / 5
+	if listWidth < 24 {
+		listWidth = 24
+	}
+	diffWidth := width - listWidth - 3
+	body := height - 2
+	if body < 1 {
+		body = 1
+	}
+
+	// keep the cursor, and the header above it, on screen
+	if ui.cursor < ui.top {
+		ui.top = ui.cursor
+	}
+	if ui.cursor > 0 && ui.rows[ui.cursor-1].entry == nil && ui.cursor-1 < ui.top {
+		ui.top = ui.cursor - 1
+	}
+	if ui.cursor >= ui.top+body {
+		ui.top = ui.cursor - body + 1
+	}
+
+	var screen strings.Builder
+	screen.WriteString(ansiHome)
+
+	status := ui.status
+	header := fmt.Sprintf(" %s -> %s", status.LocalBranch, status.RemoteBranch)
+	if status.Ahead > 0 || status.Behind > 0 {
+		header += fmt.Sprintf("  ahead %d, behind %d", status.Ahead, status.Behind)
+	}
+	if status.StashCount > 0 {
+		header += fmt.Sprintf("  %s", plural(status.StashCount, "stash"))
+	}
+	screen.WriteString(ansiReverse + fit(header, width) + ansiReset + "\r\n")
+
+	for line := 0; line < body; line++ {
+		left := ""
+		if i := ui.top + line; i < len(ui.rows) {
+			row := ui.rows[i]
+			color := categoryColors[row.category]
+			switch {
+			case row.entry == nil:
+				left = color + ansiBold + fit(fmt.Sprintf("%s (%d)", row.category, row.count), listWidth) + ansiReset
+			case i == ui.cursor:
+				left = ansiReverse + fit("  "+row.entry.displayName(), listWidth) + ansiReset
+			default:
+				left = color + fit("  "+row.entry.displayName(), listWidth) + ansiReset
+			}
+		} else if line == 0 && len(ui.rows) == 0 {
+			left = fit("Nothing to commit, working tree clean.", listWidth)
+		} else {
+			left = fit("", listWidth)
+		}
+
+		right := ""
+		if i := ui.diffTop + line; i < len(ui.diff) && diffWidth > 0 {
+			text := ui.diff[i]
+			right = diffLineColor(text) + fit(text, diffWidth) + ansiReset
+		}
+		screen.WriteString(left + ansiGray + " │ " + ansiReset + right + ansiClearLine + "\r\n")
+	}
+
+	footer := tuiHelp
+	if ui.message != "" {
+		footer = ui.message
+	}
+	screen.WriteString(ansiGray + fit(" "+footer, width-1) + ansiReset + ansiClearLine)
+	return screen.String()
+}
+
+// readKey reads one key press, arrow keys come as a single escape sequence.
+func readKey() (string, error) {
+	buf := make([]byte, 8)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	switch key := string(buf[:n]); key {
+	case "\x1b[A", "\x1bOA":
+		return "up", nil
+	case "\x1b[B", "\x1bOB":
+		return "down", nil
+	case "\x1b[5~":
+		return "pgup", nil
+	case "\x1b[6~":
+		return "pgdown", nil
+	case "\x03", "\x1b":
+		return "q", nil
+	default:
+		return key, nil
+	}
+}
+
+// confirmKey shows the question in the footer and waits for y or n.
+func (ui *statusUI) confirmKey(question string, width, height int) bool {
+	ui.message = question + " (y/n)"
+	fmt.Print(ui.render(width, height))
+	key, err := readKey()
+	ui.message = ""
+	return err == nil && (key == "y" || key == "Y")
+}
+
+// stageSelected stages the whole file, like `git add <file>`.
+func (ui *statusUI) stageSelected(entry StatusEntry) error {
+	if !hasUnstagedChanges(entry) {
+		ui.message = entry.Path + " has nothing left to stage"
+		return nil
+	}
+	if err := backend.Add(entry.Path); err != nil {
+		return err
+	}
+	ui.message = "Staged " + entry.Path
+	return nil
+}
+
+func (ui *statusUI) unstageSelected(entry StatusEntry) error {
+	if !hasStagedChanges(entry) {
+		ui.message = entry.Path + " has nothing staged"
+		return nil
+	}
+	paths := []string{entry.Path}
+	if entry.OrigPath != "" {
+		paths = append(paths, entry.OrigPath)
+	}
+	if err := unstage(paths); err != nil {
+		return err
+	}
+	ui.message = "Unstaged " + entry.Path
+	return nil
+}
+
+// discardSelected throws away every change to the file, staged or not. An
+// untracked file is deleted.
+func (ui *statusUI) discardSelected(entry StatusEntry) error {
+	if entry.Kind == "untracked" {
+		if dryRun {
+			ui.message = "dry-run: rm -r " + entry.Path
+			return nil
+		}
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return err
+		}
+		ui.message = "Deleted " + entry.Path
+		return nil
+	}
+	args := []string{"restore", "--source=HEAD", "--staged", "--worktree", "--", entry.Path}
+	if entry.OrigPath != "" {
+		args = append(args, entry.OrigPath)
+	}
+	if _, err := runGitChange(args...); err != nil {
+		return err
+	}
+	ui.message = "Discarded the changes to " + entry.Path
+	return nil
+}
+
+// ignoreSelected appends the untracked file to the .gitignore at the top of
+// the repository.
+func (ui *statusUI) ignoreSelected(entry StatusEntry) error {
+	if entry.Kind != "untracked" {
+		ui.message = "only untracked files can be ignored, " + entry.Path + " is tracked"
+		return nil
+	}
+	if dryRun {
+		ui.message = "dry-run: add /" + entry.Path + " to .gitignore"
+		return nil
+	}
+	top, err := backend.Root()
+	if err != nil {
+		return err
+	}
+	gitignore := filepath.Join(top, ".gitignore")
+
+	existing, err := os.ReadFile(gitignore)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	line := "/" + entry.Path + "\n"
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		line = "\n" + line
+	}
+	file, err := os.OpenFile(gitignore, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(line); err != nil {
+		return err
+	}
+	ui.message = "Added /" + entry.Path + " to .gitignore"
+	return nil
+}
+
+// runStatusUI opens the full-screen status view, `git-tool tui`.
+func runStatusUI() int {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "tui needs a terminal, use `git-tool status` in scripts")
+		return exitUsage
+	}
+
+	ui := &statusUI{}
+	if err := ui.load(); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	fmt.Print(ansiAltScreen + ansiHideCursor + ansiClearScreen)
+	defer func() {
+		fmt.Print(ansiShowCursor + ansiMainScreen)
+		term.Restore(int(os.Stdin.Fd()), state)
+	}()
+
+	for {
+		// read the size every time, the terminal may have been resized
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		fmt.Print(ui.render(width, height))
+
+		key, err := readKey()
+		if err != nil {
+			return exitGitError
+		}
+		ui.message = ""
+		page := height - 2
+
+		var actionErr error
+		entry := ui.selected()
+		switch key {
+		case "q":
+			return exitOK
+		case "j", "down":
+			ui.move(1)
+			ui.loadDiff()
+		case "k", "up":
+			ui.move(-1)
+			ui.loadDiff()
+		case "pgdown":
+			ui.move(page)
+			ui.loadDiff()
+		case "pgup":
+			ui.move(-page)
+			ui.loadDiff()
+		case "J":
+			if ui.diffTop+page < len(ui.diff) {
+				ui.diffTop += page / 2
+			}
+		case "K":
+			ui.diffTop -= page / 2
+			if ui.diffTop < 0 {
+				ui.diffTop = 0
+			}
+		case "r":
+			actionErr = ui.load()
+		case "s", "u", "d", "i":
+			if entry == nil {
+				continue
+			}
+			if entry.Kind == "unmerged" {
+				ui.message = entry.Path + " has conflicts, resolve them by running git-tool without a command"
+				continue
+			}
+			switch key {
+			case "s":
+				actionErr = ui.stageSelected(*entry)
+			case "u":
+				actionErr = ui.unstageSelected(*entry)
+			case "d":
+				if ui.confirmKey("Discard all changes to "+entry.Path+"? This can't be undone", width, height) {
+					actionErr = ui.discardSelected(*entry)
+				}
+			case "i":
+				actionErr = ui.ignoreSelected(*entry)
+			}
+			if actionErr == nil {
+				message := ui.message
+				actionErr = ui.load()
+				ui.message = message
+			}
+		}
+		if actionErr != nil {
+			ui.message = "error " + strings.ReplaceAll(strings.TrimSpace(actionErr.Error()), "\n", " ")
+		}
+	}
+}
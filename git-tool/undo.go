@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// how many actions the journal keeps
+const maxJournalActions = 50
+
+// Action is one change git-tool made, kept in the journal so `git-tool undo`
+// can take it back.
+type Action struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // "add" or "commit"
+	Branch string    `json:"branch,omitempty"`
+
+	// add: the index before and after, written out as trees
+	TreeBefore string   `json:"tree_before,omitempty"`
+	TreeAfter  string   `json:"tree_after,omitempty"`
+	Paths      []string `json:"paths,omitempty"` // empty for add --all
+
+	// commit: the new commit and HEAD before it, empty for the first commit
+	Commit  string `json:"commit,omitempty"`
+	Parent  string `json:"parent,omitempty"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// journalPath is .git/gittool-journal, `git rev-parse --git-path` so linked
+// worktrees get their own.
+func journalPath(dir string) (string, error) {
+	output, err := runGitIn(dir, "rev-parse", "--git-path", "gittool-journal")
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(output)
+	if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path, nil
+}
+
+func readJournal(dir string) ([]Action, error) {
+	path, err := journalPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var actions []Action
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var action Action
+		// a damaged line shouldn't make the older actions unreachable
+		if json.Unmarshal(lines.Bytes(), &action) == nil {
+			actions = append(actions, action)
+		}
+	}
+	return actions, lines.Err()
+}
+
+func writeJournal(dir string, actions []Action) error {
+	path, err := journalPath(dir)
+	if err != nil {
+		return err
+	}
+	if len(actions) > maxJournalActions {
+		actions = actions[len(actions)-maxJournalActions:]
+	}
+	var data []byte
+	for _, action := range actions {
+		line, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func recordAction(dir string, action Action) error {
+	actions, err := readJournal(dir)
+	if err != nil {
+		return err
+	}
+	action.Time = time.Now()
+	if branch, err := runGitIn(dir, "branch", "--show-current"); err == nil {
+		action.Branch = strings.TrimSpace(branch)
+	}
+	return writeJournal(dir, append(actions, action))
+}
+
+// journalBackend records the adds and commits that go through it. The
+// journal is best effort, the change itself has already happened when
+// recording fails, so those errors are only printed.
+type journalBackend struct {
+	GitBackend
+	dir string
+}
+
+func (b journalBackend) Add(paths ...string) error {
+	// write-tree fails while there are unmerged paths, those adds can't be undone
+	before, beforeErr := runGitIn(b.dir, "write-tree")
+	if err := b.GitBackend.Add(paths...); err != nil {
+		return err
+	}
+	after, afterErr := runGitIn(b.dir, "write-tree")
+	if beforeErr != nil || afterErr != nil || before == after {
+		return nil
+	}
+	action := Action{Kind: "add", TreeBefore: strings.TrimSpace(before), TreeAfter: strings.TrimSpace(after), Paths: paths}
+	if err := recordAction(b.dir, action); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: could not record the add for undo:", err)
+	}
+	return nil
+}
+
+func (b journalBackend) Commit(message string) (string, error) {
+	parent, _ := runGitIn(b.dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	output, err := b.GitBackend.Commit(message)
+	if err != nil {
+		return output, err
+	}
+	head, err := runGitIn(b.dir, "rev-parse", "HEAD")
+	if err != nil {
+		return output, nil
+	}
+	action := Action{
+		Kind:    "commit",
+		Commit:  strings.TrimSpace(head),
+		Parent:  strings.TrimSpace(parent),
+		Subject: strings.SplitN(message, "\n", 2)[0],
+	}
+	if err := recordAction(b.dir, action); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: could not record the commit for undo:", err)
+	}
+	return output, nil
+}
+
+// isPushed reports whether the commit is on any remote-tracking branch.
+func isPushed(commit string) bool {
+	output, err := runGit("branch", "--remotes", "--contains", commit)
+	return err == nil && strings.TrimSpace(output) != ""
+}
+
+// undoPlan describes how the action would be undone, or why it can't be.
+func undoPlan(action Action) (description string, preview string, err error) {
+	switch action.Kind {
+	case "add":
+		current, err := runGit("write-tree")
+		if err != nil {
+			return "", "", fmt.Errorf("the index has unmerged paths, resolve them first")
+		}
+		preview, _ = runGit("diff", "--stat", action.TreeBefore, action.TreeAfter)
+		description = "Unstage what this add staged, the files in the working tree are not touched."
+		if strings.TrimSpace(current) != action.TreeAfter {
+			description += "\nWarning: the index changed since, those later changes are unstaged too."
+		}
+		return description, preview, nil
+
+	case "commit":
+		preview, _ = runGit("show", "--stat", "--format=%h %s", action.Commit)
+		if isPushed(action.Commit) {
+			if _, err := runGit("merge-base", "--is-ancestor", action.Commit, "HEAD"); err != nil {
+				return "", "", fmt.Errorf("commit %s is not on the current branch", action.Commit[:7])
+			}
+			description = "The commit was pushed, a revert commit undoing it is created on top. Push it afterwards."
+			return description, preview, nil
+		}
+
+		// resetting is only safe while HEAD is still the commit we made, the
+		// reflog says what happened since
+		reflog, err := runGit("reflog", "-1", "--format=%H%x00%gs", "HEAD")
+		if err != nil {
+			return "", "", err
+		}
+		fields := strings.SplitN(strings.TrimSpace(reflog), "\x00", 2)
+		if fields[0] != action.Commit {
+			return "", "", fmt.Errorf("HEAD moved since commit %s, the reflog shows %q", action.Commit[:7], fields[len(fields)-1])
+		}
+		description = "The commit was not pushed, it is removed and its changes stay staged."
+		return description, preview, nil
+	}
+	return "", "", fmt.Errorf("unknown action %q in the journal", action.Kind)
+}
+
+func undoAction(action Action) error {
+	switch action.Kind {
+	case "add":
+		_, err := runGitChange("read-tree", action.TreeBefore)
+		return err
+	case "commit":
+		if isPushed(action.Commit) {
+			_, err := runGitChange("revert", "--no-edit", action.Commit)
+			return err
+		}
+		if action.Parent == "" {
+			// the first commit, go back to the unborn branch with the files staged
+			_, err := runGitChange("update-ref", "-d", "HEAD")
+			return err
+		}
+		_, err := runGitChange("reset", "--soft", action.Parent)
+		return err
+	}
+	return fmt.Errorf("unknown action %q in the journal", action.Kind)
+}
+
+func describeAction(action Action) string {
+	when := humanAge(action.Time)
+	switch action.Kind {
+	case "add":
+		paths := "everything"
+		if len(action.Paths) > 0 {
+			paths = strings.Join(action.Paths, " ")
+		}
+		return fmt.Sprintf("add %s on %s, %s", paths, action.Branch, when)
+	case "commit":
+		return fmt.Sprintf("commit %s %q on %s, %s", action.Commit[:7], action.Subject, action.Branch, when)
+	}
+	return action.Kind
+}
+
+// undoCommand takes back the last add or commit made with git-tool, after
+// showing what will change. Undone actions leave the journal, so running it
+// again goes one step further back.
+func undoCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: git-tool undo")
+		return exitUsage
+	}
+	if operation := inProgressOperation(); operation != "" {
+		fmt.Fprintf(os.Stderr, "a %s is in progress, finish or abort it first\n", operation)
+		return exitConflict
+	}
+
+	actions, err := readJournal("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to undo, git-tool has not added or committed anything here.")
+		return exitOK
+	}
+	last := actions[len(actions)-1]
+
+	fmt.Println("Last action:", describeAction(last))
+	description, preview, err := undoPlan(last)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "can't undo:", err)
+		return exitBlocked
+	}
+	if preview != "" {
+		fmt.Println()
+		fmt.Print(preview)
+		fmt.Println()
+	}
+	fmt.Println(description)
+	if cont() != "1" {
+		return exitOK
+	}
+
+	reverted := last.Kind == "commit" && isPushed(last.Commit)
+	if err := undoAction(last); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if dryRun {
+		return exitOK
+	}
+	remaining := actions[:len(actions)-1]
+	if reverted {
+		// the adds that went into a reverted commit are history now, unstaging
+		// them would only undo the revert
+		for len(remaining) > 0 && remaining[len(remaining)-1].Kind == "add" {
+			remaining = remaining[:len(remaining)-1]
+		}
+	}
+	if err := writeJournal("", remaining); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	fmt.Println("Undone.")
+	return exitOK
+}
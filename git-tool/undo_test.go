@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUndoAdd(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("a.txt", "a\n")
+	repo.commitAll("chore: init")
+	repo.write("a.txt", "changed\n")
+	repo.write("b.txt", "b\n")
+
+	runCLIOrFail(t, "add", "a.txt")
+	runCLIOrFail(t, "add", "b.txt")
+	runCLIOrFail(t, "--yes", "undo")
+	if staged := strings.Fields(repo.git("diff", "--cached", "--name-only")); len(staged) != 1 || staged[0] != "a.txt" {
+		t.Errorf("staged after one undo = %q, want a.txt", staged)
+	}
+	runCLIOrFail(t, "--yes", "undo")
+	if staged := repo.git("diff", "--cached", "--name-only"); staged != "" {
+		t.Errorf("staged after two undos = %q, want nothing", staged)
+	}
+	if changed := strings.TrimSpace(repo.git("status", "--porcelain")); changed != "M a.txt\n?? b.txt" {
+		t.Errorf("status = %q, the working tree must not change", changed)
+	}
+}
+
+func TestUndoUnpushedCommit(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("a.txt", "a\n")
+	repo.commitAll("chore: init")
+	parent := repo.git("rev-parse", "HEAD")
+	repo.write("b.txt", "b\n")
+
+	runCLIOrFail(t, "add", "b.txt")
+	runCLIOrFail(t, "commit", "-m", "feat: b")
+	runCLIOrFail(t, "--yes", "undo")
+	if head := repo.git("rev-parse", "HEAD"); head != parent {
+		t.Errorf("HEAD = %s, want the parent %s", head, parent)
+	}
+	if staged := strings.TrimSpace(repo.git("diff", "--cached", "--name-only")); staged != "b.txt" {
+		t.Errorf("staged = %q, want b.txt kept staged", staged)
+	}
+}
+
+func TestUndoFirstCommit(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("a.txt", "a\n")
+
+	runCLIOrFail(t, "add", "a.txt")
+	runCLIOrFail(t, "commit", "-m", "feat: first")
+	runCLIOrFail(t, "--yes", "undo")
+	if head, err := runGit("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		t.Errorf("HEAD = %s, want the unborn branch", head)
+	}
+	if staged := strings.TrimSpace(repo.git("diff", "--cached", "--name-only")); staged != "a.txt" {
+		t.Errorf("staged = %q, want a.txt kept staged", staged)
+	}
+}
+
+func TestUndoPushedCommitReverts(t *testing.T) {
+	repo := newTestRepo(t)
+	bare := repo.newBareRemote()
+	repo.write("a.txt", "a\n")
+	repo.commitAll("chore: init")
+	repo.git("push", "--quiet", "--set-upstream", "origin", "feature")
+	repo.write("b.txt", "b\n")
+
+	runCLIOrFail(t, "add", "b.txt")
+	runCLIOrFail(t, "commit", "-m", "feat: b")
+	runCLIOrFail(t, "--yes", "push")
+	runCLIOrFail(t, "--yes", "undo")
+
+	subjects := strings.Split(strings.TrimSpace(repo.git("log", "--format=%s")), "\n")
+	if len(subjects) != 3 || !strings.HasPrefix(subjects[0], "Revert ") {
+		t.Errorf("log = %q, want a revert on top of the pushed commit", subjects)
+	}
+	if got := remoteLog(t, bare, "feature"); len(got) != 2 {
+		t.Errorf("remote = %q, the revert is not pushed by undo", got)
+	}
+	if changed := repo.git("status", "--porcelain"); changed != "" {
+		t.Errorf("status after the revert = %q, want clean", changed)
+	}
+
+	// the add that went into the reverted commit left the journal with it
+	runCLIOrFail(t, "--yes", "undo")
+	if head := strings.TrimSpace(repo.git("log", "-1", "--format=%s")); head != subjects[0] {
+		t.Errorf("second undo changed HEAD to %q", head)
+	}
+}
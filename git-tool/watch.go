@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ignoredDirectories lists the ignored directories of the working tree, like
+// node_modules or build output, which aren't worth a watch each.
+func ignoredDirectories(top string) map[string]bool {
+	ignored := make(map[string]bool)
+	output, err := runGitIn(top, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return ignored
+	}
+	for _, path := range strings.Split(output, "\x00") {
+		if strings.HasSuffix(path, "/") {
+			ignored[filepath.Join(top, path)] = true
+		}
+	}
+	return ignored
+}
+
+// addWatches watches dir and every directory under it except .git and the
+// ignored ones. inotify watches aren't recursive, so each directory needs
+// its own.
+func addWatches(watcher *fsnotify.Watcher, dir string, ignored map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// a directory deleted while walking isn't worth failing for
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || ignored[path] {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// isNoise reports events that don't change the status: lock files git
+// creates and deletes around every write, and permission changes.
+func isNoise(event fsnotify.Event) bool {
+	return strings.HasSuffix(event.Name, ".lock") || event.Op == fsnotify.Chmod
+}
+
+func redrawStatus(top string) {
+	status, err := loadGitStatus()
+	// clear the screen and move to the top left corner
+	fmt.Print("\x1b[H\x1b[2J")
+	fmt.Printf("Watching %s, Ctrl-C to stop. Updated %s\n\n", top, time.Now().Format("15:04:05"))
+	if err != nil {
+		fmt.Println("error", err)
+		return
+	}
+	printStatus(status)
+}
+
+// watchCommand redraws the status whenever the working tree or the
+// repository changes, waiting for a quiet moment so a burst of writes, like
+// a checkout or a build, causes a single redraw.
+func watchCommand(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	debounce := flags.Duration("debounce", 300*time.Millisecond, "wait for `duration` without changes before redrawing")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	output, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	top := strings.TrimSpace(output)
+	repoDir, err := filepath.Abs(gitDir())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+
+	// git status refreshes the index when it can, which would wake the
+	// watcher up again right after every redraw
+	os.Setenv("GIT_OPTIONAL_LOCKS", "0")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	defer watcher.Close()
+
+	ignored := ignoredDirectories(top)
+	if err := addWatches(watcher, top, ignored); err != nil {
+		fmt.Fprintln(os.Stderr, "error watching the working tree:", err)
+		return exitGitError
+	}
+	// HEAD and the index live in the git dir, branch tips under refs
+	if err := watcher.Add(repoDir); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if err := addWatches(watcher, filepath.Join(repoDir, "refs"), nil); err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	redrawStatus(top)
+	timer := time.NewTimer(*debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return exitOK
+			}
+			if isNoise(event) {
+				continue
+			}
+			// new directories need a watch of their own, except the ones git
+			// makes for a rebase or merge right in the git dir
+			if event.Has(fsnotify.Create) && filepath.Dir(event.Name) != repoDir {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatches(watcher, event.Name, ignored)
+				}
+			}
+			timer.Reset(*debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return exitOK
+			}
+			fmt.Fprintln(os.Stderr, "error", err)
+		case <-timer.C:
+			redrawStatus(top)
+		case <-interrupt:
+			fmt.Println()
+			return exitOK
+		}
+	}
+}
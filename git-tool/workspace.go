@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// repoReport is the scan result for one repository.
+type repoReport struct {
+	Path      string
+	Status    GitStatus
+	Operation string // merge/rebase/... in progress
+	Protected bool   // the branch is protected in the repository's settings
+	Err       error
+}
+
+// findRepositories walks root and returns every directory holding a .git
+// directory or a .git file (worktrees and submodules). It keeps descending
+// into repositories so nested checkouts are found too.
+func findRepositories(root string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable directories are skipped, not fatal
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Name() == ".git" {
+			repos = append(repos, filepath.Dir(path))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	sort.Strings(repos)
+	return repos, err
+}
+
+// scanRepositories reads the status of every repo with at most jobs git
+// processes running at once.
+func scanRepositories(repos []string, jobs int) []repoReport {
+	reports := make([]repoReport, len(repos))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				reports[i] = readRepository(repos[i])
+			}
+		}()
+	}
+	for i := range repos {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return reports
+}
+
+// readRepository reads the status and the unfinished operation of the
+// repository at dir.
+func readRepository(dir string) repoReport {
+	report := repoReport{Path: dir, Status: GitStatus{RemoteBranch: "no remote"}}
+	repoBackend, err := newBackend(dir)
+	if err == nil {
+		report.Status, err = repoBackend.Status()
+	}
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	if repoGitDir, err := repoBackend.GitDir(); err == nil {
+		report.Operation = operationInGitDir(repoGitDir)
+	}
+	repoSettings, err := loadSettings(repoBackend)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	report.Protected = indexOf(repoSettings.ProtectedBranches, report.Status.LocalBranch) >= 0
+	return report
+}
+
+func (r repoReport) noRemote() bool {
+	return r.Err == nil && r.Status.Upstream == ""
+}
+
+func (r repoReport) needsAttention() bool {
+	status := r.Status
+	return r.Err != nil || r.Operation != "" || !status.isClean() ||
+		status.Ahead > 0 || status.Behind > 0 || r.noRemote() || status.UpstreamGone
+}
+
+// isCleanCut is true for repos that can be committed and pushed without
+// any decision from the user: local changes, no conflicts, a tracked
+// upstream that isn't ahead of us and a branch that isn't protected.
+func (r repoReport) isCleanCut() bool {
+	status := r.Status
+	return r.Err == nil && r.Operation == "" && !status.isClean() && !r.Protected &&
+		len(status.Conflicted) == 0 && !status.Detached &&
+		status.Upstream != "" && !status.UpstreamGone && status.Behind == 0
+}
+
+func (r repoReport) state() string {
+	if r.Err != nil {
+		return "error"
+	}
+	var states []string
+	if r.Operation != "" {
+		states = append(states, r.Operation)
+	}
+	if len(r.Status.Conflicted) > 0 {
+		states = append(states, "conflicts")
+	}
+	if !r.Status.isClean() {
+		states = append(states, fmt.Sprintf("dirty(%d)", len(r.Status.Entries)))
+	}
+	if len(states) == 0 {
+		return "clean"
+	}
+	return strings.Join(states, ",")
+}
+
+func printWorkspaceTable(root string, reports []repoReport) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "REPO\tBRANCH\tSTATE\tAHEAD\tBEHIND\tUPSTREAM")
+
+	clean := 0
+	for _, report := range reports {
+		if !report.needsAttention() {
+			clean++
+			continue
+		}
+		name, err := filepath.Rel(root, report.Path)
+		if err != nil {
+			name = report.Path
+		}
+		upstream := report.Status.Upstream
+		switch {
+		case report.Err != nil:
+			upstream = report.Err.Error()
+		case upstream == "":
+			upstream = "no remote"
+		case report.Status.UpstreamGone:
+			upstream += " (gone)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%s\n", name, report.Status.LocalBranch,
+			report.state(), report.Status.Ahead, report.Status.Behind, upstream)
+	}
+	table.Flush()
+	fmt.Printf("\n%d repositories, %d clean.\n", len(reports), clean)
+}
+
+// commitAndPush stages everything in the repo, commits it and pushes to the
+// upstream. Only used for clean-cut repos, which have an upstream.
+func commitAndPush(dir string, branch string, message string) error {
+	repoBackend, err := newBackend(dir)
+	if err != nil {
+		return err
+	}
+	remote, mergeRef := upstreamForIn(repoBackend, branch)
+	if remote == "" {
+		return fmt.Errorf("could not read the upstream of %s", branch)
+	}
+	if err := repoBackend.Add(); err != nil {
+		return err
+	}
+	repoSettings, err := loadSettings(repoBackend)
+	if err != nil {
+		return err
+	}
+	findings, err := runPreCommitChecks(repoBackend, loadCheckConfig(repoBackend, repoSettings.PreCommitChecks))
+	if err != nil {
+		return err
+	}
+	if len(findings) > 0 {
+		// the changes stay staged so the user can look at them
+		printFindings(findings)
+		return fmt.Errorf("pre-commit checks failed, not committed")
+	}
+	if _, err := repoBackend.Commit(message); err != nil {
+		return err
+	}
+	_, err = repoBackend.Push(remote, mergeRef, false)
+	return err
+}
+
+func scanCommand(args []string) int {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of repositories to read at the same time")
+	commitPush := flags.Bool("commit-push", false, "commit everything and push in the clean-cut repositories")
+	message := flags.String("m", "", "commit `message` for --commit-push")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *jobs < 1 {
+		*jobs = 1
+	}
+	if *commitPush {
+		if err := validateCommitMessage(*message); err != nil {
+			fmt.Fprintln(os.Stderr, "scan: --commit-push needs a valid -m:", err)
+			return exitUsage
+		}
+	}
+
+	root := "."
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitUsage
+	}
+
+	repos, err := findRepositories(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		return exitGitError
+	}
+	if len(repos) == 0 {
+		fmt.Println("No git repositories found under", root)
+		return exitOK
+	}
+
+	reports := scanRepositories(repos, *jobs)
+	printWorkspaceTable(root, reports)
+
+	exitCode := exitOK
+	var cleanCut, protected []repoReport
+	for _, report := range reports {
+		if report.Err != nil {
+			exitCode = exitGitError
+		} else if report.needsAttention() && exitCode == exitOK {
+			exitCode = exitDirty
+		}
+		if report.isCleanCut() {
+			cleanCut = append(cleanCut, report)
+		} else if report.Protected && !report.Status.isClean() {
+			protected = append(protected, report)
+		}
+	}
+
+	if !*commitPush {
+		return exitCode
+	}
+	for _, report := range protected {
+		fmt.Printf("Skipping %s, %s is a protected branch.\n", report.Path, report.Status.LocalBranch)
+	}
+	if len(cleanCut) == 0 {
+		return exitCode
+	}
+
+	fmt.Printf("\nCommit and push %d clean-cut repositories with %q?\n", len(cleanCut), *message)
+	for _, report := range cleanCut {
+		fmt.Println(" ", report.Path)
+	}
+	if cont() != "1" {
+		return exitCode
+	}
+	for _, report := range cleanCut {
+		if err := commitAndPush(report.Path, report.Status.LocalBranch, *message); err != nil {
+			fmt.Println("error", report.Path, err)
+			exitCode = exitGitError
+			continue
+		}
+		fmt.Println("Pushed", report.Path)
+	}
+	return exitCode
+}
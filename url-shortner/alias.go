@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 32
+)
+
+// ErrInvalidAlias is wrapped by every error validateAlias returns
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// letters, digits, - and _, starting and ending with a letter or digit so
+// aliases like q3-report work but -x- or a trailing dot don't
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9_-]*[A-Za-z0-9])?$`)
+
+// reservedWords can't be aliases, the server uses them or will, like /api/links.
+// they are checked without case so Admin or API are out too
+var reservedWords = []string{"api", "admin", "static"}
+
+func isReserved(code string) bool {
+	for _, word := range reservedWords {
+		if strings.EqualFold(code, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAlias says what is wrong with an alias the user asked for, nil if
+// it can be used as a code
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w %q: must be %d to %d characters long", ErrInvalidAlias, alias, minAliasLength, maxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w %q: only letters, digits, - and _ are allowed, and it must start and end with a letter or digit", ErrInvalidAlias, alias)
+	}
+	if isReserved(alias) {
+		return fmt.Errorf("%w %q: %s is a reserved word", ErrInvalidAlias, alias, strings.ToLower(alias))
+	}
+	return nil
+}
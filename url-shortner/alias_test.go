@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateAlias(t *testing.T) {
+	valid := []string{"q3-report", "abc", "A_b-9"}
+	invalid := []string{"ab", "-q3", "q3-", "q3 report", "q3/report", "Admin", "static", string(make([]byte, maxAliasLength+1))}
+	for _, alias := range valid {
+		if err := validateAlias(alias); err != nil {
+			t.Errorf("validateAlias(%q) = %v", alias, err)
+		}
+	}
+	for _, alias := range invalid {
+		if err := validateAlias(alias); !errors.Is(err, ErrInvalidAlias) {
+			t.Errorf("validateAlias(%q) = %v, want ErrInvalidAlias", alias, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Click is one resolve or redirect of a link
+type Click struct {
+	Code      string    `json:"code"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer,omitempty"` // only the host, like news.ycombinator.com
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
+}
+
+// newClick makes the click for a visit. the full referrer and the address are
+// never stored: the referrer is cut to its host and the address to its
+// network, /24 for IPv4 and /48 for IPv6, which is hashed with the secret of
+// the store. that is still enough to count unique visitors roughly
+func newClick(code string, referrer string, userAgent string, remoteAddr string) Click {
+	click := Click{Code: code, Time: time.Now().UTC(), UserAgent: userAgent}
+	if u, err := url.Parse(referrer); err == nil {
+		click.Referrer = strings.ToLower(u.Hostname())
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	if ip := net.ParseIP(remoteAddr); ip != nil {
+		network := ip.Mask(net.CIDRMask(48, 128))
+		if ip4 := ip.To4(); ip4 != nil {
+			network = ip4.Mask(net.CIDRMask(24, 32))
+		}
+		mac := hmac.New(sha256.New, store.Secret())
+		mac.Write([]byte(network.String()))
+		click.IPHash = hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	return click
+}
+
+// recordClick stores a click, a failure is only printed since the visitor
+// should still get where they were going
+func recordClick(click Click) {
+	if err := store.AddClick(click); err != nil {
+		fmt.Fprintln(os.Stderr, "error recording a click on", click.Code+":", err)
+	}
+}
+
+// DayClicks is the number of clicks on one day
+type DayClicks struct {
+	Day    string `json:"day"` // 2006-01-02, in UTC
+	Clicks int    `json:"clicks"`
+}
+
+// ReferrerClicks is the number of clicks coming from one site
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"` // empty for direct visits and the CLI
+	Clicks   int    `json:"clicks"`
+}
+
+// Analytics sums up the clicks of one link
+type Analytics struct {
+	Code           string           `json:"code"`
+	TotalClicks    int              `json:"total_clicks"`
+	UniqueVisitors int              `json:"unique_visitors"`
+	ClicksPerDay   []DayClicks      `json:"clicks_per_day"` // oldest first, days without clicks left out
+	TopReferrers   []ReferrerClicks `json:"top_referrers"`
+}
+
+const topReferrers = 10
+
+func analyze(code string, clicks []Click) Analytics {
+	analytics := Analytics{
+		Code:         code,
+		TotalClicks:  len(clicks),
+		ClicksPerDay: []DayClicks{},
+		TopReferrers: []ReferrerClicks{},
+	}
+	visitors := make(map[string]bool)
+	days := make(map[string]int)
+	referrers := make(map[string]int)
+	for _, click := range clicks {
+		// clicks from the menu have no address, they count as one visitor
+		visitors[click.IPHash] = true
+		days[click.Time.UTC().Format("2006-01-02")]++
+		referrers[click.Referrer]++
+	}
+	analytics.UniqueVisitors = len(visitors)
+
+	for day, count := range days {
+		analytics.ClicksPerDay = append(analytics.ClicksPerDay, DayClicks{day, count})
+	}
+	sort.Slice(analytics.ClicksPerDay, func(i, j int) bool {
+		return analytics.ClicksPerDay[i].Day < analytics.ClicksPerDay[j].Day
+	})
+
+	for referrer, count := range referrers {
+		analytics.TopReferrers = append(analytics.TopReferrers, ReferrerClicks{referrer, count})
+	}
+	sort.Slice(analytics.TopReferrers, func(i, j int) bool {
+		a, b := analytics.TopReferrers[i], analytics.TopReferrers[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.Referrer < b.Referrer
+	})
+	if len(analytics.TopReferrers) > topReferrers {
+		analytics.TopReferrers = analytics.TopReferrers[:topReferrers]
+	}
+	return analytics
+}
+
+// printAnalytics is the menu version of the analytics endpoint
+func printAnalytics(analytics Analytics) {
+	fmt.Println(" Total clicks:", analytics.TotalClicks)
+	fmt.Println(" Unique visitors:", analytics.UniqueVisitors)
+	if len(analytics.ClicksPerDay) > 0 {
+		fmt.Println(" Clicks per day:")
+		for _, day := range analytics.ClicksPerDay {
+			fmt.Printf("   %s  %d\n", day.Day, day.Clicks)
+		}
+	}
+	if len(analytics.TopReferrers) > 0 {
+		fmt.Println(" Top referrers:")
+		for _, referrer := range analytics.TopReferrers {
+			name := referrer.Referrer
+			if name == "" {
+				name = "(direct)"
+			}
+			fmt.Printf("   %-30s %d\n", name, referrer.Clicks)
+		}
+	}
+}
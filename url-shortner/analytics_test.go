@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewClick(t *testing.T) {
+	store = newMemoryStore()
+	a := newClick("abcd", "https://News.Example.com/item?id=1", "curl", "203.0.113.7:51234")
+	b := newClick("abcd", "", "curl", "203.0.113.200:4000")
+	c := newClick("abcd", "", "curl", "198.51.100.7:4000")
+	if a.Referrer != "news.example.com" {
+		t.Errorf("referrer = %q, want only the host", a.Referrer)
+	}
+	if a.IPHash == "" || a.IPHash != b.IPHash || a.IPHash == c.IPHash {
+		t.Errorf("hashes %q %q %q, want the same /24 to share a hash", a.IPHash, b.IPHash, c.IPHash)
+	}
+	if v6 := newClick("abcd", "", "", "[2001:db8:1:2::1]:80"); v6.IPHash != newClick("abcd", "", "", "[2001:db8:1:3::9]:80").IPHash {
+		t.Error("addresses in the same /48 should share a hash")
+	}
+
+	// another installation has another secret, its hashes can't be compared
+	store = newMemoryStore()
+	if other := newClick("abcd", "", "curl", "203.0.113.7:51234"); other.IPHash == a.IPHash {
+		t.Errorf("hash %q is the same with a different secret", other.IPHash)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	clicks := []Click{
+		{Time: day2, Referrer: "a.com", IPHash: "1"},
+		{Time: day1, Referrer: "b.com", IPHash: "1"},
+		{Time: day2, Referrer: "b.com", IPHash: "2"},
+		{Time: day2, IPHash: "3"},
+	}
+	got := analyze("abcd", clicks)
+	want := Analytics{
+		Code:           "abcd",
+		TotalClicks:    4,
+		UniqueVisitors: 3,
+		ClicksPerDay:   []DayClicks{{"2026-03-01", 1}, {"2026-03-02", 3}},
+		TopReferrers:   []ReferrerClicks{{"b.com", 2}, {"", 1}, {"a.com", 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("analyze = %+v\nwant %+v", got, want)
+	}
+}
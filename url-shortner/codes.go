@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// CodeGenerator makes the codes of links without an alias. shortenURL asks
+// Next for a code, tries to store it and calls Used when that worked, so a
+// generator never has to know about the store itself
+type CodeGenerator interface {
+	Next() (string, error)
+	Used(code string)
+}
+
+// newCodeGenerator makes the generator picked with the -codes flag. links are
+// the ones already stored, the generators carry on from them
+func newCodeGenerator(kind string, length int, grow float64, salt string, links []Link) (CodeGenerator, error) {
+	switch kind {
+	case "random":
+		if length < 1 {
+			return nil, fmt.Errorf("code length must be at least 1, not %d", length)
+		}
+		if grow <= 0 || grow > 1 {
+			return nil, fmt.Errorf("grow threshold must be above 0 and at most 1, not %g", grow)
+		}
+		return newRandomGenerator(length, grow, links), nil
+	case "counter":
+		return &counterGenerator{next: uint64(len(links))}, nil
+	case "hashids":
+		return newHashidsGenerator(salt, uint64(len(links))), nil
+	}
+	return nil, fmt.Errorf("unknown code generator %q, use random, counter or hashids", kind)
+}
+
+// randomGenerator draws codes from crypto/rand. it starts at length characters
+// and moves to longer codes once grow of the codes of the current length are
+// taken, so collisions stay rare instead of piling up as the space fills
+type randomGenerator struct {
+	mu        sync.Mutex
+	minLength int
+	grow      float64
+	used      map[int]int // codes stored per length
+}
+
+func newRandomGenerator(length int, grow float64, links []Link) *randomGenerator {
+	g := &randomGenerator{minLength: length, grow: grow, used: make(map[int]int)}
+	for _, link := range links {
+		g.used[len(link.Code)]++
+	}
+	return g
+}
+
+// length is the shortest length at or above minLength that is still below
+// the threshold. the caller holds g.mu
+func (g *randomGenerator) length() int {
+	length := g.minLength
+	for float64(g.used[length]) >= g.grow*math.Pow(float64(len(letters)), float64(length)) {
+		length++
+	}
+	return length
+}
+
+func (g *randomGenerator) Next() (string, error) {
+	g.mu.Lock()
+	length := g.length()
+	g.mu.Unlock()
+
+	code := make([]byte, 0, length)
+	buf := make([]byte, length*2)
+	for len(code) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// 248 is the largest multiple of 62 that fits a byte, bytes above it
+			// are dropped so every letter is equally likely
+			if b < 248 && len(code) < length {
+				code = append(code, letters[int(b)%len(letters)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+func (g *randomGenerator) Used(code string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.used[len(code)]++
+}
+
+// encodeBase62 writes n with the digits of alphabet, most significant first
+func encodeBase62(n uint64, alphabet string) string {
+	if n == 0 {
+		return alphabet[:1]
+	}
+	var digits []byte
+	for n > 0 {
+		digits = append(digits, alphabet[n%uint64(len(alphabet))])
+		n /= uint64(len(alphabet))
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+func decodeBase62(code string, alphabet string) (uint64, bool) {
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(alphabet, code[i])
+		if digit < 0 {
+			return 0, false
+		}
+		n = n*uint64(len(alphabet)) + uint64(digit)
+	}
+	return n, true
+}
+
+// counterGenerator hands out 0, 1, 2, ... in base62, the shortest codes
+// possible but easy to guess. it starts at the number of stored links, codes
+// that are taken by an alias or another generator are skipped by shortenURL
+type counterGenerator struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+func (g *counterGenerator) Next() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	code := encodeBase62(g.next, letters)
+	g.next++
+	return code, nil
+}
+
+func (g *counterGenerator) Used(code string) {}
+
+// hashidsGenerator counts like counterGenerator but scrambles the numbers
+// the way hashids does, so the codes don't show how many links there are.
+// with the salt they can be turned back into the number with decode
+type hashidsGenerator struct {
+	counter  counterGenerator
+	alphabet string // letters shuffled with the salt
+	salt     string
+}
+
+func newHashidsGenerator(salt string, start uint64) *hashidsGenerator {
+	return &hashidsGenerator{
+		counter:  counterGenerator{next: start},
+		alphabet: shuffle(letters, salt),
+		salt:     salt,
+	}
+}
+
+// shuffle is the consistent shuffle of hashids, the same alphabet and salt
+// always give the same order
+func shuffle(alphabet string, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	shuffled := []byte(alphabet)
+	for i, v, p := len(shuffled)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		v++
+	}
+	return string(shuffled)
+}
+
+// encode picks a lottery character from n and writes n in the alphabet
+// shuffled once more with it, so neighbouring numbers look nothing alike
+func (g *hashidsGenerator) encode(n uint64) string {
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	return string(lottery) + encodeBase62(n, shuffle(g.alphabet, string(lottery)+g.salt))
+}
+
+// decode is encode backwards, false for codes encode can't have made
+func (g *hashidsGenerator) decode(code string) (uint64, bool) {
+	if len(code) < 2 {
+		return 0, false
+	}
+	n, ok := decodeBase62(code[1:], shuffle(g.alphabet, code[:1]+g.salt))
+	if !ok || g.encode(n) != code {
+		return 0, false
+	}
+	return n, true
+}
+
+func (g *hashidsGenerator) Next() (string, error) {
+	g.counter.mu.Lock()
+	defer g.counter.mu.Unlock()
+	code := g.encode(g.counter.next)
+	g.counter.next++
+	return code, nil
+}
+
+func (g *hashidsGenerator) Used(code string) {}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestRandomGeneratorGrows(t *testing.T) {
+	// with a threshold of 1/62 one-character codes are full after a single one
+	g := newRandomGenerator(1, 1.0/62, []Link{{Code: "a"}})
+	code, err := g.Next()
+	if err != nil || len(code) != 2 {
+		t.Fatalf("Next = %q, %v, want a code of length 2", code, err)
+	}
+	if g = newRandomGenerator(3, 0.5, nil); len(must(g.Next())) != 3 {
+		t.Error("an empty store should get codes of the minimum length")
+	}
+}
+
+func TestCounterGenerator(t *testing.T) {
+	g := &counterGenerator{next: 61}
+	for _, want := range []string{"9", "ba", "bb"} {
+		if got := must(g.Next()); got != want {
+			t.Errorf("Next = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHashidsRoundTrip(t *testing.T) {
+	g := newHashidsGenerator("my salt", 0)
+	other := newHashidsGenerator("other salt", 0)
+	seen := make(map[string]bool)
+	for n := uint64(0); n < 1000; n++ {
+		code := g.encode(n)
+		if seen[code] {
+			t.Fatalf("%q made twice", code)
+		}
+		seen[code] = true
+		if got, ok := g.decode(code); !ok || got != n {
+			t.Errorf("decode(%q) = %d, %v, want %d", code, got, ok, n)
+		}
+	}
+	if g.encode(42) == other.encode(42) {
+		t.Error("different salts should give different codes")
+	}
+	if _, ok := g.decode("!x"); ok {
+		t.Error("decode accepted a code encode can't make")
+	}
+}
+
+func must(code string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return code
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidURL is wrapped by every error normalizeURL returns
+var ErrInvalidURL = errors.New("invalid URL")
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizeURL checks that raw is an http or https URL and writes it the same
+// way every time: lowercase scheme and host, no default port, / for an empty
+// path. so https://Example.com:443 and https://example.com/ are one link
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: it is empty", ErrInvalidURL)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Parse errors repeat the whole input, the reason is enough
+		var parseErr *url.Error
+		if errors.As(err, &parseErr) {
+			err = parseErr.Err
+		}
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidURL, raw, err)
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("%w %q: the scheme is missing, start it with http:// or https://", ErrInvalidURL, raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w %q: the %s scheme isn't allowed, only http and https", ErrInvalidURL, raw, u.Scheme)
+	}
+	// mailto-like http:example.com has no // and ends up in Opaque
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w %q: there is no host", ErrInvalidURL, raw)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return "", fmt.Errorf("%w %q: there is no host", ErrInvalidURL, raw)
+	}
+	host = strings.ToLower(host)
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%w %q: port %s is out of range", ErrInvalidURL, raw, port)
+		}
+	}
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 needs its brackets back
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
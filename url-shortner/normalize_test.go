@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"https://Example.COM", "https://example.com/"},
+		{"HTTP://example.com:80/a?b=c", "http://example.com/a?b=c"},
+		{"https://example.com:443/Path", "https://example.com/Path"},
+		{"http://example.com:8080", "http://example.com:8080/"},
+		{"https://[::1]:443/x", "https://[::1]/x"},
+		{"  https://example.com/x  ", "https://example.com/x"},
+	}
+	for _, test := range tests {
+		if got, err := normalizeURL(test.raw); err != nil || got != test.want {
+			t.Errorf("normalizeURL(%q) = %q, %v, want %q", test.raw, got, err, test.want)
+		}
+	}
+
+	rejected := map[string]string{
+		"":                       "empty",
+		"example.com":            "scheme is missing",
+		"javascript:alert(1)":    "javascript scheme",
+		"ftp://example.com":      "ftp scheme",
+		"http:example.com":       "no host",
+		"https://":               "no host",
+		"https://example.com:0/": "out of range",
+		"https://exa mple.com/":  "invalid character",
+	}
+	for raw, reason := range rejected {
+		_, err := normalizeURL(raw)
+		if !errors.Is(err, ErrInvalidURL) || !strings.Contains(err.Error(), reason) {
+			t.Errorf("normalizeURL(%q) = %v, want an ErrInvalidURL about %q", raw, err, reason)
+		}
+	}
+}
+
+func TestShortenURLDedupe(t *testing.T) {
+	store = newMemoryStore()
+	reuseExisting = true
+	defer func() { reuseExisting = false }()
+
+	first, existing, err := shortenURL("https://Example.com:443/report", "")
+	if err != nil || existing {
+		t.Fatalf("first shortenURL = %q, %v, %v", first, existing, err)
+	}
+	again, existing, err := shortenURL("https://example.com/report", "")
+	if err != nil || !existing || again != first {
+		t.Errorf("second shortenURL = %q, %v, %v, want %q again", again, existing, err, first)
+	}
+	// an alias is always a new code
+	if aliased, existing, err := shortenURL("https://example.com/report", "report"); err != nil || existing || aliased != domain+"report" {
+		t.Errorf("shortenURL with an alias = %q, %v, %v", aliased, existing, err)
+	}
+}
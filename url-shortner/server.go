@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// linkResponse is what the API returns for a link
+type linkResponse struct {
+	Code      string    `json:"code"`
+	ShortURL  string    `json:"short_url"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// server serves the redirects and the JSON API. the handlers run at the same
+// time, which is fine because the stores do their own locking: Create only
+// adds a code that is still free, so shortenURL can't hand one out twice
+type server struct {
+	redirectStatus int // 301 or 302
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/links", s.createLink)
+	mux.HandleFunc("GET /api/links/{code}", s.getLink)
+	mux.HandleFunc("GET /api/links/{code}/analytics", s.getAnalytics)
+	mux.HandleFunc("GET /{code}", s.redirect)
+	return mux
+}
+
+// shortLink is the address the link is served at, the host the request came in on
+func shortLink(r *http.Request, code string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + code
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func (s *server) redirect(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	original, ok, err := resolveURL(code)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		fmt.Fprintln(os.Stderr, "error", err)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	recordClick(newClick(code, r.Referer(), r.UserAgent(), r.RemoteAddr))
+	http.Redirect(w, r, original, s.redirectStatus)
+}
+
+func (s *server) createLink(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		URL   string `json:"url"`
+		Alias string `json:"alias"` // optional, a random code when empty
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	short, existing, err := shortenURL(request.URL, request.Alias)
+	if errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrInvalidAlias) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, ErrCodeTaken) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		fmt.Fprintln(os.Stderr, "error", err)
+		return
+	}
+	code := strings.TrimPrefix(short, domain)
+	link, _, err := store.Get(code)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		fmt.Fprintln(os.Stderr, "error", err)
+		return
+	}
+	status := http.StatusCreated
+	if existing {
+		status = http.StatusOK // nothing new was made
+	}
+	w.Header().Set("Location", "/api/links/"+code)
+	writeJSON(w, status, linkResponse{code, shortLink(r, code), link.URL, link.CreatedAt})
+}
+
+func (s *server) getLink(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	link, ok, err := store.Get(code)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		fmt.Fprintln(os.Stderr, "error", err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "no link with code "+code)
+		return
+	}
+	writeJSON(w, http.StatusOK, linkResponse{code, shortLink(r, code), link.URL, link.CreatedAt})
+}
+
+func (s *server) getAnalytics(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	_, ok, err := store.Get(code)
+	var clicks []Click
+	if err == nil && ok {
+		clicks, err = store.Clicks(code)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		fmt.Fprintln(os.Stderr, "error", err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "no link with code "+code)
+		return
+	}
+	writeJSON(w, http.StatusOK, analyze(code, clicks))
+}
+
+// serve runs the HTTP server until it fails or gets Ctrl-C
+func serve(addr string, redirectStatus int) error {
+	if redirectStatus != http.StatusMovedPermanently && redirectStatus != http.StatusFound {
+		return fmt.Errorf("redirect status must be 301 or 302, not %d", redirectStatus)
+	}
+	s := &server{redirectStatus: redirectStatus}
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-interrupt
+		// let the requests in flight finish, the store is closed after this
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	fmt.Println(" Serving on", addr, "Ctrl-C to stop")
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// ListenAndServe returns as soon as Shutdown starts, wait for it to finish
+	<-shutdown
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	store = newMemoryStore()
+	handler := (&server{redirectStatus: http.StatusFound}).routes()
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	created := request("POST", "/api/links", `{"url": "https://example.com/page"}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("POST /api/links = %d %s", created.Code, created.Body)
+	}
+	var link linkResponse
+	if err := json.Unmarshal(created.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.URL != "https://example.com/page" || link.ShortURL != "http://example.com/"+link.Code {
+		t.Errorf("created link = %+v", link)
+	}
+
+	redirect := request("GET", "/"+link.Code, "")
+	if redirect.Code != http.StatusFound || redirect.Header().Get("Location") != link.URL {
+		t.Errorf("GET /%s = %d to %q", link.Code, redirect.Code, redirect.Header().Get("Location"))
+	}
+	if metadata := request("GET", "/api/links/"+link.Code, ""); metadata.Code != http.StatusOK {
+		t.Errorf("GET /api/links/%s = %d", link.Code, metadata.Code)
+	}
+	var analytics Analytics
+	response := request("GET", "/api/links/"+link.Code+"/analytics", "")
+	if err := json.Unmarshal(response.Body.Bytes(), &analytics); err != nil || analytics.TotalClicks != 1 {
+		t.Errorf("analytics after one redirect = %d %s", response.Code, response.Body)
+	}
+
+	if missing := request("GET", "/nope", ""); missing.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown code = %d, want 404", missing.Code)
+	}
+	if bad := request("POST", "/api/links", `{"link": "x"}`); bad.Code != http.StatusBadRequest {
+		t.Errorf("POST with an unknown field = %d, want 400", bad.Code)
+	}
+
+	if aliased := request("POST", "/api/links", `{"url": "https://example.com/q3", "alias": "q3-report"}`); aliased.Code != http.StatusCreated {
+		t.Errorf("POST with a free alias = %d %s", aliased.Code, aliased.Body)
+	}
+	if taken := request("POST", "/api/links", `{"url": "https://example.com/other", "alias": "q3-report"}`); taken.Code != http.StatusConflict {
+		t.Errorf("POST with a taken alias = %d, want 409", taken.Code)
+	}
+	if reserved := request("POST", "/api/links", `{"url": "https://example.com", "alias": "api"}`); reserved.Code != http.StatusBadRequest {
+		t.Errorf("POST with a reserved alias = %d, want 400", reserved.Code)
+	}
+}
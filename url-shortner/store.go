@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCodeTaken is returned by Store.Create when the code is already used
+var ErrCodeTaken = errors.New("short code already taken")
+
+// Link is one short link
+type Link struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps the links. Create only adds a link if the code is free, so two
+// shortenURL calls can never hand out the same code
+type Store interface {
+	Create(link Link) error
+	Get(code string) (Link, bool, error)
+	FindURL(url string) (Link, bool, error) // the oldest link to url
+	All() ([]Link, error)                   // sorted by code
+	AddClick(click Click) error
+	Clicks(code string) ([]Click, error) // oldest first
+	Secret() []byte                      // key of the visitor hashes, made randomly on the first run
+	Close() error
+}
+
+// newSecret returns the key for a new installation. it has to stay private,
+// with it the hashes of the few million /24 networks can be tried one by one
+func newSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// openStore opens the store picked with the -store flag
+func openStore(kind string, path string) (Store, error) {
+	switch kind {
+	case "memory":
+		return newMemoryStore(), nil
+	case "json":
+		return openJSONStore(path)
+	case "bolt":
+		return openBoltStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q, use memory, json or bolt", kind)
+}
+
+// memoryStore is the old urlMap, everything is gone on exit
+type memoryStore struct {
+	mu     sync.RWMutex
+	links  map[string]Link
+	clicks map[string][]Click
+	secret []byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{links: make(map[string]Link), clicks: make(map[string][]Click), secret: newSecret()}
+}
+
+func (s *memoryStore) Secret() []byte {
+	return s.secret
+}
+
+func (s *memoryStore) Create(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.links[link.Code]; exists {
+		return ErrCodeTaken
+	}
+	s.links[link.Code] = link
+	return nil
+}
+
+func (s *memoryStore) Get(code string) (Link, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, exists := s.links[code]
+	return link, exists, nil
+}
+
+func (s *memoryStore) FindURL(url string) (Link, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found Link
+	for _, link := range s.links {
+		if link.URL == url && (found.Code == "" || link.CreatedAt.Before(found.CreatedAt)) {
+			found = link
+		}
+	}
+	return found, found.Code != "", nil
+}
+
+func (s *memoryStore) All() ([]Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Code < links[j].Code })
+	return links, nil
+}
+
+func (s *memoryStore) AddClick(click Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clicks[click.Code] = append(s.clicks[click.Code], click)
+	return nil
+}
+
+func (s *memoryStore) Clicks(code string) ([]Click, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Click(nil), s.clicks[code]...), nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// jsonStore is a memoryStore that rewrites a JSON file after every change.
+// clicks go to a second file, path.clicks, one JSON line each, since
+// rewriting everything on every redirect would be far too slow
+type jsonStore struct {
+	*memoryStore
+	path     string
+	clickLog *os.File
+}
+
+func openJSONStore(path string) (*jsonStore, error) {
+	s := &jsonStore{memoryStore: newMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// no file is the first run, it is made on the first link
+	if err == nil {
+		var links []Link
+		if err := json.Unmarshal(data, &links); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, link := range links {
+			s.links[link.Code] = link
+		}
+	}
+
+	if err := s.loadClicks(); err != nil {
+		return nil, err
+	}
+	if s.secret, err = loadSecret(path + ".secret"); err != nil {
+		return nil, err
+	}
+	s.clickLog, err = os.OpenFile(path+".clicks", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadSecret reads the secret next to the data file, making it on the first run
+func loadSecret(path string) ([]byte, error) {
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	secret = newSecret()
+	// O_EXCL, a second process starting at the same time must not overwrite it
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(secret); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return secret, file.Close()
+}
+
+func (s *jsonStore) loadClicks() error {
+	file, err := os.Open(s.path + ".clicks")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var click Click
+		// a crash in the middle of an append leaves half a line, skip it
+		if json.Unmarshal(scanner.Bytes(), &click) == nil {
+			s.clicks[click.Code] = append(s.clicks[click.Code], click)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *jsonStore) AddClick(click Click) error {
+	line, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a single write with O_APPEND, so lines from two requests never mix
+	if _, err := s.clickLog.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.clicks[click.Code] = append(s.clicks[click.Code], click)
+	return nil
+}
+
+func (s *jsonStore) Close() error {
+	return s.clickLog.Close()
+}
+
+func (s *jsonStore) Create(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.links[link.Code]; exists {
+		return ErrCodeTaken
+	}
+	s.links[link.Code] = link
+	if err := s.save(); err != nil {
+		delete(s.links, link.Code) // keep memory and file the same
+		return err
+	}
+	return nil
+}
+
+// save writes the links to a temp file next to the data file and renames it
+// over the old one. rename is atomic, so after a crash the file is either
+// the old or the new version, never half written. the caller holds s.mu
+func (s *jsonStore) save() error {
+	links := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Code < links[j].Code })
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed, that's fine
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// the data has to be on disk before the rename makes it the real file
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// and the rename itself has to reach the disk too
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
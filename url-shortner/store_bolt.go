@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	linksBucket  = []byte("links")
+	clicksBucket = []byte("clicks") // a bucket per code in here, keyed by sequence number
+	metaBucket   = []byte("meta")
+	secretKey    = []byte("secret")
+)
+
+// boltStore keeps the links in a bbolt file, every change is a transaction
+// so a crash can't leave it half written
+type boltStore struct {
+	db     *bolt.DB
+	secret []byte
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	// the timeout stops us from hanging when another process has the file open
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	s := &boltStore{db: db}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(linksBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(clicksBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		// values are only valid during the transaction, keep a copy
+		if secret := meta.Get(secretKey); secret != nil {
+			s.secret = append([]byte(nil), secret...)
+			return nil
+		}
+		s.secret = newSecret()
+		return meta.Put(secretKey, s.secret)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *boltStore) Secret() []byte {
+	return s.secret
+}
+
+func (s *boltStore) Create(link Link) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		if bucket.Get([]byte(link.Code)) != nil {
+			return ErrCodeTaken
+		}
+		return bucket.Put([]byte(link.Code), value)
+	})
+}
+
+func (s *boltStore) Get(code string) (Link, bool, error) {
+	var link Link
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(linksBucket).Get([]byte(code))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &link)
+	})
+	return link, found, err
+}
+
+// FindURL reads every link, there is no index by url. that is fine for the
+// number of links one of these files holds
+func (s *boltStore) FindURL(url string) (Link, bool, error) {
+	var found Link
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(linksBucket).ForEach(func(key, value []byte) error {
+			var link Link
+			if err := json.Unmarshal(value, &link); err != nil {
+				return err
+			}
+			if link.URL == url && (found.Code == "" || link.CreatedAt.Before(found.CreatedAt)) {
+				found = link
+			}
+			return nil
+		})
+	})
+	return found, found.Code != "", err
+}
+
+func (s *boltStore) All() ([]Link, error) {
+	links := []Link{}
+	// bolt keeps keys sorted, so this is already in code order
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(linksBucket).ForEach(func(key, value []byte) error {
+			var link Link
+			if err := json.Unmarshal(value, &link); err != nil {
+				return err
+			}
+			links = append(links, link)
+			return nil
+		})
+	})
+	return links, err
+}
+
+func (s *boltStore) AddClick(click Click) error {
+	value, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(clicksBucket).CreateBucketIfNotExists([]byte(click.Code))
+		if err != nil {
+			return err
+		}
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		// big endian so the keys, and with them the clicks, sort by sequence
+		return bucket.Put(binary.BigEndian.AppendUint64(nil, sequence), value)
+	})
+}
+
+func (s *boltStore) Clicks(code string) ([]Click, error) {
+	var clicks []Click
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clicksBucket).Bucket([]byte(code))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var click Click
+			if err := json.Unmarshal(value, &click); err != nil {
+				return err
+			}
+			clicks = append(clicks, click)
+			return nil
+		})
+	})
+	return clicks, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	for _, kind := range []string{"memory", "json", "bolt"} {
+		t.Run(kind, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "links")
+			s, err := openStore(kind, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			link := Link{Code: "abcd", URL: "https://example.com", CreatedAt: time.Now().UTC()}
+			if err := s.Create(link); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Create(Link{Code: "abcd", URL: "https://other.com"}); !errors.Is(err, ErrCodeTaken) {
+				t.Errorf("second Create of abcd = %v, want ErrCodeTaken", err)
+			}
+			secret := s.Secret()
+			if len(secret) != 32 {
+				t.Errorf("Secret = %x, want 32 random bytes", secret)
+			}
+			for _, referrer := range []string{"a.com", "b.com"} {
+				if err := s.AddClick(Click{Code: "abcd", Referrer: referrer}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if kind == "memory" {
+				return
+			}
+
+			// the link and its clicks have to survive a reopen
+			s, err = openStore(kind, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			got, ok, err := s.Get("abcd")
+			if err != nil || !ok || got.URL != link.URL || !got.CreatedAt.Equal(link.CreatedAt) {
+				t.Errorf("Get after reopen = %+v, %v, %v", got, ok, err)
+			}
+			if links, _ := s.All(); len(links) != 1 {
+				t.Errorf("All after reopen = %+v, want one link", links)
+			}
+			if clicks, err := s.Clicks("abcd"); err != nil || len(clicks) != 2 || clicks[1].Referrer != "b.com" {
+				t.Errorf("Clicks after reopen = %+v, %v, want both in order", clicks, err)
+			}
+			if !bytes.Equal(s.Secret(), secret) {
+				t.Errorf("Secret after reopen = %x, want %x", s.Secret(), secret)
+			}
+		})
+	}
+}
@@ -3,49 +3,139 @@ package main
 import (
 	"fmt"
 	"bufio"
-	"math/rand"
+	"errors"
+	"flag"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
-var urlMap = make(map[string]string)
+var store Store // where the links live, picked with -store in main
+var reuseExisting bool // -dedupe, hand out the code a url already has instead of a new one
+var shortenLock sync.Mutex // makes looking for the existing code and creating a new one one step
 const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 const domain = "short.url/"
 
-func generateShortURL () string {
-	// this will generate a random combination of letters for the prefix of our short url
-	b := make([]byte, 4) // a slice of size 4
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+// codes makes the codes of links without an alias, picked with -codes in main
+var codes CodeGenerator = newRandomGenerator(4, 0.5, nil)
+
+// shortenURL stores the url under alias, or under a random code when alias is
+// empty. existing is true when -dedupe found the url already shortened and
+// short is its old code
+func shortenURL(originalURL string, alias string) (short string, existing bool, err error) {
+	originalURL, err = normalizeURL(originalURL)
+	if err != nil {
+		return "", false, err
+	}
+
+	if alias != "" {
+		// an alias is asked for on purpose, so it gets made even if the url has a code already
+		alias = strings.TrimPrefix(alias, domain) // short.url/q3-report works too
+		if err := validateAlias(alias); err != nil {
+			return "", false, err
+		}
+		err := store.Create(Link{Code: alias, URL: originalURL, CreatedAt: time.Now()})
+		if errors.Is(err, ErrCodeTaken) {
+			return "", false, fmt.Errorf("%w: %q, pick another one", err, alias)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		codes.Used(alias) // aliases fill up the random codes of their length too
+		return domain + alias, false, nil
 	}
-	return string(b)
-}
 
-func shortenURL(originalURL string) string {
-	shortCode := generateShortURL()
-	for urlMap[shortCode] != "" {
-		// checks if the shortCode generated already exists with a original url, means urlMap[shortcode generated] must be empty
-		shortCode = generateShortURL()
+	if reuseExisting {
+		// without the lock two requests for the same url could both miss and make two codes
+		shortenLock.Lock()
+		defer shortenLock.Unlock()
+		link, found, err := store.FindURL(originalURL)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			return domain + link.Code, true, nil
+		}
+	}
+
+	for {
+		shortCode, err := codes.Next()
+		if err != nil {
+			return "", false, err
+		}
+		if isReserved(shortCode) {
+			continue
+		}
+		// Create refuses a code that already exists, then we just try another one
+		err = store.Create(Link{Code: shortCode, URL: originalURL, CreatedAt: time.Now()})
+		if errors.Is(err, ErrCodeTaken) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		codes.Used(shortCode)
+		return domain + shortCode, false, nil
 	}
-	urlMap[shortCode] = originalURL
-	return domain + shortCode
 }
 
-func resolveURL(short string) (string, bool) {
+func resolveURL(short string) (string, bool, error) {
 	if strings.HasPrefix(short, domain) {
 		short = strings.TrimPrefix(short, domain)
 	}
-	original, exists := urlMap[short] // stores original url in urlMap[inserted short url code], if exists true otherwise false, map return value and a bool ok
-	return original, exists
+	link, exists, err := store.Get(short) // if exists true otherwise false
+	return link.URL, exists, err
 }
 
 func main () {
-	rand.Seed(time.Now().UnixNano()) // random generate every time 
+	storeKind := flag.String("store", "json", "where to keep the links: memory, json or bolt")
+	dataPath := flag.String("data", "", "data `file` for the json and bolt stores (default urls.json or urls.db)")
+	serveAddr := flag.String("serve", "", "serve the links over HTTP on `address`, like :8080, instead of the menu")
+	redirectStatus := flag.Int("redirect", 302, "HTTP status of the redirects, 301 or 302")
+	flag.BoolVar(&reuseExisting, "dedupe", false, "return the existing short URL when a URL was shortened before")
+	codeKind := flag.String("codes", "random", "how to make codes: random, counter or hashids")
+	codeLength := flag.Int("length", 4, "shortest `length` of the random codes")
+	grow := flag.Float64("grow", 0.5, "make random codes one longer once this `fraction` of the current length is taken")
+	salt := flag.String("salt", "", "salt of the hashids codes, keep it the same between runs")
+	flag.Parse()
+	if *dataPath == "" {
+		*dataPath = "urls.json"
+		if *storeKind == "bolt" {
+			*dataPath = "urls.db"
+		}
+	}
+	var err error
+	store, err = openStore(*storeKind, *dataPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	links, err := store.All()
+	if err == nil {
+		codes, err = newCodeGenerator(*codeKind, *codeLength, *grow, *salt, links)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		store.Close()
+		os.Exit(1)
+	}
+
+	if *serveAddr != "" {
+		if err := serve(*serveAddr, *redirectStatus); err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			store.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
 	scanner := bufio.NewScanner(os.Stdin) // creates a scanner that reads input from the keyboard
   
 	for {
-		fmt.Println("\n 1.Shorten URL \n 2.Resolve URL \n 3.Quit \n 4.Print map")
+		fmt.Println("\n 1.Shorten URL \n 2.Resolve URL \n 3.Quit \n 4.Print map \n 5.Analytics")
 		fmt.Print(" Enter a choice: ")
 		scanner.Scan()
 		choice := strings.TrimSpace(scanner.Text())
@@ -55,13 +145,28 @@ func main () {
 			fmt.Print(" Enter original URL: ")
 			scanner.Scan()
 			originalURL := strings.TrimSpace(scanner.Text())
-			short := shortenURL(originalURL)
-			fmt.Println(" Short URL:", short)
+			fmt.Print(" Enter an alias (empty for a random one): ")
+			scanner.Scan()
+			alias := strings.TrimSpace(scanner.Text())
+			short, existing, err := shortenURL(originalURL, alias)
+			if err != nil {
+				fmt.Println(" error", err)
+				continue
+			}
+			if existing {
+				fmt.Println(" Already shortened:", short)
+			} else {
+				fmt.Println(" Short URL:", short)
+			}
 		case "2":
 			fmt.Print(" Enter the short URL to resolve: ")
 			scanner.Scan()
 			shortURL := strings.TrimSpace(scanner.Text())
-			if original, ok := resolveURL(shortURL); ok {
+			original, ok, err := resolveURL(shortURL)
+			if err != nil {
+				fmt.Println(" error", err)
+			} else if ok {
+				recordClick(newClick(strings.TrimPrefix(shortURL, domain), "", "", ""))
 				fmt.Println(" Original URL:", original)
 			} else {
 				fmt.Println(" Short URL not found")
@@ -72,7 +177,32 @@ func main () {
 			return
 
 		case "4":
-			fmt.Println("\n", urlMap)
+			links, err := store.All()
+			if err != nil {
+				fmt.Println(" error", err)
+				continue
+			}
+			fmt.Println()
+			for _, link := range links {
+				fmt.Println(" " + link.Code, "->", link.URL)
+			}
+
+		case "5":
+			fmt.Print(" Enter the short URL: ")
+			scanner.Scan()
+			code := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), domain)
+			_, ok, err := store.Get(code)
+			var clicks []Click
+			if err == nil && ok {
+				clicks, err = store.Clicks(code)
+			}
+			if err != nil {
+				fmt.Println(" error", err)
+			} else if !ok {
+				fmt.Println(" Short URL not found")
+			} else {
+				printAnalytics(analyze(code, clicks))
+			}
 
 		default:
 			fmt.Println(" Invalid Choice")